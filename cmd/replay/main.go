@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/api"
+)
+
+func main() {
+	logger := log.New(os.Stdout, "sciplayer-replay ", log.LstdFlags|log.LUTC)
+
+	target := flag.String("target", "http://localhost:8090", "base URL of the server to replay against")
+	file := flag.String("file", "data/capture.jsonl", "capture file written by the server's capture mode")
+	device := flag.String("device", "", "replace the captured device identifier with this one")
+	realtime := flag.Bool("realtime", false, "preserve the original spacing between requests")
+	flag.Parse()
+
+	exchanges, err := readCapture(*file)
+	if err != nil {
+		logger.Fatalf("reading capture: %v", err)
+	}
+	if len(exchanges) == 0 {
+		logger.Fatalf("capture %s contains no requests", *file)
+	}
+
+	baseURL := strings.TrimRight(*target, "/")
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	var mismatches, expected int
+	for i, exchange := range exchanges {
+		if *realtime && i > 0 {
+			time.Sleep(exchange.Time.Sub(exchanges[i-1].Time))
+		}
+
+		body, err := exchange.RequestPayload()
+		if err != nil {
+			logger.Printf("%s %s: %v", exchange.Method, exchange.Path, err)
+			mismatches++
+			continue
+		}
+
+		path := exchange.Path
+		if *device != "" {
+			path = rewriteDevice(path, *device)
+			if exchange.Method == http.MethodPost && path == "/devices" && exchange.RequestBodyEncoding == "" {
+				body = rewriteRegistration(body, *device)
+			}
+		}
+
+		status, err := replay(client, baseURL, path, exchange, body)
+		if err != nil {
+			logger.Printf("%s %s: %v", exchange.Method, path, err)
+			mismatches++
+			continue
+		}
+
+		if status != exchange.Status {
+			// The credentials the device sent were redacted in the capture,
+			// so the server rightly answers differently.
+			if exchange.RequestRedacted {
+				logger.Printf("%s %s: status %d, captured %d (expected, credentials redacted)", exchange.Method, path, status, exchange.Status)
+				expected++
+				continue
+			}
+			logger.Printf("%s %s: status %d, captured %d", exchange.Method, path, status, exchange.Status)
+			mismatches++
+			continue
+		}
+
+		logger.Printf("%s %s: %d", exchange.Method, path, status)
+	}
+
+	logger.Printf("replayed %d requests, %d mismatches, %d expected from redacted credentials", len(exchanges), mismatches, expected)
+	if mismatches > 0 {
+		os.Exit(1)
+	}
+}
+
+func readCapture(path string) ([]api.CapturedExchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	var exchanges []api.CapturedExchange
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var exchange api.CapturedExchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+
+	return exchanges, scanner.Err()
+}
+
+func rewriteDevice(path, deviceID string) string {
+	rest, ok := strings.CutPrefix(path, "/devices/")
+	if !ok {
+		return path
+	}
+	if _, tail, found := strings.Cut(rest, "/"); found {
+		return "/devices/" + deviceID + "/" + tail
+	}
+	return "/devices/" + deviceID
+}
+
+// rewriteRegistration replaces deviceId in a captured registration body, so
+// the device is registered under the identifier the other requests use.
+// Bodies that are not a JSON object with a deviceId are returned unchanged.
+func rewriteRegistration(body []byte, deviceID string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	if _, ok := fields["deviceId"]; !ok {
+		return body
+	}
+
+	id, err := json.Marshal(deviceID)
+	if err != nil {
+		return body
+	}
+	fields["deviceId"] = id
+
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+func replay(client *http.Client, baseURL, path string, exchange api.CapturedExchange, body []byte) (int, error) {
+	target := baseURL + path
+	if exchange.Query != "" {
+		target += "?" + exchange.Query
+	}
+
+	var reader io.Reader
+	if len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(exchange.Method, target, reader)
+	if err != nil {
+		return 0, fmt.Errorf("building request: %w", err)
+	}
+	for key, value := range exchange.RequestHeaders {
+		if value == "[redacted]" || strings.EqualFold(key, "Content-Length") {
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
@@ -1,33 +1,174 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"sciplayer-api/internal/api"
+	"sciplayer-api/internal/archive"
+	"sciplayer-api/internal/sessions"
+	"sciplayer-api/internal/store"
 	"sciplayer-api/internal/store/sqlite"
+	"sciplayer-api/internal/upstream"
 )
 
 func main() {
 	logger := log.New(os.Stdout, "sciplayer-api ", log.LstdFlags|log.LUTC)
 
 	dbPath := envOrDefault("SCIPLAYER_DB_PATH", "data/sciplayer.db")
-	addr := envOrDefault("SCIPLAYER_HTTP_ADDR", ":8090")
+	localMode := os.Getenv("SCIPLAYER_LOCAL_MODE") == "true"
 
-	store, err := sqlite.New(dbPath)
+	// Local mode runs on the player itself, so only listen on loopback
+	// unless told otherwise.
+	defaultAddr := ":8090"
+	if localMode {
+		defaultAddr = "127.0.0.1:8090"
+	}
+	addr := envOrDefault("SCIPLAYER_HTTP_ADDR", defaultAddr)
+	env := envOrDefault("SCIPLAYER_ENV", "production")
+
+	faultInjection := os.Getenv("SCIPLAYER_FAULT_INJECTION") == "true"
+	if faultInjection && env == "production" {
+		logger.Fatalf("fault injection cannot be enabled when SCIPLAYER_ENV is production")
+	}
+
+	uniqueness, err := store.ParsePlaylistUniqueness(os.Getenv("SCIPLAYER_PLAYLIST_UNIQUENESS"))
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	maxPlaylists, err := int64OrDefault("SCIPLAYER_MAX_PLAYLISTS_PER_DEVICE", 0)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	slowQuery, err := durationOrDefault("SCIPLAYER_SLOW_QUERY_THRESHOLD", 200*time.Millisecond)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	db, err := sqlite.New(dbPath, sqlite.Options{
+		PlaylistUniqueness:    uniqueness,
+		MaxPlaylistsPerDevice: int(maxPlaylists),
+		SlowQueryThreshold:    slowQuery,
+		Logger:                logger,
+	})
 	if err != nil {
 		logger.Fatalf("failed to initialize sqlite store: %v", err)
 	}
 	defer func() {
-		if err := store.Close(); err != nil {
+		if err := db.Close(); err != nil {
 			logger.Printf("error closing store: %v", err)
 		}
 	}()
 
-	handler := api.New(store, logger)
+	driftThreshold, err := durationOrDefault("SCIPLAYER_CLOCK_DRIFT_THRESHOLD", 2*time.Second)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	storageWarning, err := int64OrDefault("SCIPLAYER_STORAGE_WARNING_BYTES", 0)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	maxReads, err := int64OrDefault("SCIPLAYER_MAX_INFLIGHT_READS", 256)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	maxWrites, err := int64OrDefault("SCIPLAYER_MAX_INFLIGHT_WRITES", 32)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	staleAfter, err := durationOrDefault("SCIPLAYER_DEVICE_STALE_AFTER", 2*time.Minute)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	offlineAfter, err := durationOrDefault("SCIPLAYER_DEVICE_OFFLINE_AFTER", 10*time.Minute)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+	if offlineAfter < staleAfter {
+		logger.Fatalf("invalid configuration: SCIPLAYER_DEVICE_OFFLINE_AFTER must not be shorter than SCIPLAYER_DEVICE_STALE_AFTER")
+	}
+
+	openRegistrationLimit, err := int64OrDefault("SCIPLAYER_OPEN_REGISTRATION_LIMIT", 0)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	openRegistrationWindow, err := durationOrDefault("SCIPLAYER_OPEN_REGISTRATION_WINDOW", time.Hour)
+	if err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	verifyURL := os.Getenv("SCIPLAYER_REGISTRATION_VERIFY_URL")
+	verifySecret := os.Getenv("SCIPLAYER_REGISTRATION_VERIFY_SECRET")
+	if verifyURL != "" && verifySecret == "" {
+		logger.Fatalf("invalid configuration: SCIPLAYER_REGISTRATION_VERIFY_SECRET is required when SCIPLAYER_REGISTRATION_VERIFY_URL is set")
+	}
+
+	cfg := api.Config{
+		EnableFaultInjection: faultInjection,
+		NTPServers:           splitList(envOrDefault("SCIPLAYER_NTP_SERVERS", "pool.ntp.org")),
+		ClockDriftThreshold:  driftThreshold,
+		StorageWarningBytes:  storageWarning,
+		MaxInFlightReads:     int(maxReads),
+		MaxInFlightWrites:    int(maxWrites),
+		RetryAfterSeconds:    1,
+		DeviceStaleAfter:     staleAfter,
+		DeviceOfflineAfter:   offlineAfter,
+
+		RequireRegistrationToken: os.Getenv("SCIPLAYER_REQUIRE_REGISTRATION_TOKEN") == "true",
+		OpenRegistrationLimit:    int(openRegistrationLimit),
+		OpenRegistrationWindow:   openRegistrationWindow,
+		RegistrationVerifyURL:    verifyURL,
+		RegistrationVerifySecret: verifySecret,
+		AdminToken:               os.Getenv("SCIPLAYER_ADMIN_TOKEN"),
+	}
+
+	if deviceID := os.Getenv("SCIPLAYER_CAPTURE_DEVICE"); deviceID != "" {
+		capturePath := envOrDefault("SCIPLAYER_CAPTURE_PATH", "data/capture.jsonl")
+		captureFile, err := os.OpenFile(capturePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			logger.Fatalf("failed to open capture file: %v", err)
+		}
+		defer func() {
+			if err := captureFile.Close(); err != nil {
+				logger.Printf("error closing capture file: %v", err)
+			}
+		}()
+
+		cfg.CaptureDeviceID = deviceID
+		cfg.CaptureOutput = captureFile
+		logger.Printf("capturing traffic for device %s to %s", deviceID, capturePath)
+	}
+
+	handler := api.New(db, logger, cfg)
+
+	if err := startDeviceArchival(db, logger); err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	if err := startSessionCloser(db, offlineAfter, logger); err != nil {
+		logger.Fatalf("invalid configuration: %v", err)
+	}
+
+	if localMode {
+		if err := startUpstreamSync(db, logger); err != nil {
+			logger.Fatalf("invalid configuration: %v", err)
+		}
+	}
 
 	httpServer := &http.Server{
 		Addr:         addr,
@@ -44,9 +185,132 @@ func main() {
 	}
 }
 
+// startUpstreamSync mirrors the local device's playlists from a central
+// server when SCIPLAYER_UPSTREAM_URL is configured.
+func startUpstreamSync(s store.Store, logger *log.Logger) error {
+	upstreamURL := os.Getenv("SCIPLAYER_UPSTREAM_URL")
+	if upstreamURL == "" {
+		logger.Printf("local mode without upstream sync")
+		return nil
+	}
+
+	deviceID := os.Getenv("SCIPLAYER_LOCAL_DEVICE_ID")
+	if deviceID == "" {
+		return errors.New("SCIPLAYER_LOCAL_DEVICE_ID is required when SCIPLAYER_UPSTREAM_URL is set")
+	}
+
+	interval, err := durationOrDefault("SCIPLAYER_SYNC_INTERVAL", 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.New("SCIPLAYER_SYNC_INTERVAL must be positive")
+	}
+
+	syncer := upstream.NewSyncer(upstreamURL, deviceID, s, interval, logger)
+	go syncer.Run(context.Background())
+
+	logger.Printf("mirroring device %s from %s every %s", deviceID, upstreamURL, interval)
+	return nil
+}
+
+// startDeviceArchival archives devices that have not checked in for
+// SCIPLAYER_DEVICE_ARCHIVE_AFTER. Archival is off when it is unset.
+func startDeviceArchival(s store.Store, logger *log.Logger) error {
+	after, err := durationOrDefault("SCIPLAYER_DEVICE_ARCHIVE_AFTER", 0)
+	if err != nil {
+		return err
+	}
+	if after <= 0 {
+		return nil
+	}
+
+	warning, err := durationOrDefault("SCIPLAYER_DEVICE_ARCHIVE_WARNING", 24*time.Hour)
+	if err != nil {
+		return err
+	}
+	if warning < 0 || warning >= after {
+		return errors.New("SCIPLAYER_DEVICE_ARCHIVE_WARNING must be shorter than SCIPLAYER_DEVICE_ARCHIVE_AFTER")
+	}
+
+	interval, err := durationOrDefault("SCIPLAYER_DEVICE_ARCHIVE_INTERVAL", time.Hour)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.New("SCIPLAYER_DEVICE_ARCHIVE_INTERVAL must be positive")
+	}
+
+	archiver := archive.NewArchiver(s, after, warning, interval, logger)
+	go archiver.Run(context.Background())
+
+	logger.Printf("archiving devices inactive for %s, warning %s ahead", after, warning)
+	return nil
+}
+
+// startSessionCloser closes the playback sessions of devices that have not
+// checked in for SCIPLAYER_SESSION_TIMEOUT, which defaults to the offline
+// threshold.
+func startSessionCloser(s store.Store, offlineAfter time.Duration, logger *log.Logger) error {
+	timeout, err := durationOrDefault("SCIPLAYER_SESSION_TIMEOUT", offlineAfter)
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		return errors.New("SCIPLAYER_SESSION_TIMEOUT must be positive")
+	}
+
+	interval, err := durationOrDefault("SCIPLAYER_SESSION_SWEEP_INTERVAL", time.Minute)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.New("SCIPLAYER_SESSION_SWEEP_INTERVAL must be positive")
+	}
+
+	closer := sessions.NewCloser(s, timeout, interval, logger)
+	go closer.Run(context.Background())
+
+	return nil
+}
+
 func envOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func durationOrDefault(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return parsed, nil
+}
+
+func int64OrDefault(key string, defaultValue int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return parsed, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
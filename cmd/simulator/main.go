@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type config struct {
+	target       string
+	devices      int
+	prefix       string
+	pollInterval time.Duration
+	playlists    int
+	duration     time.Duration
+}
+
+func (c config) validate() error {
+	switch {
+	case c.devices <= 0:
+		return errors.New("-devices must be positive")
+	case c.pollInterval <= 0:
+		return errors.New("-poll-interval must be positive")
+	case c.playlists < 0:
+		return errors.New("-playlists must not be negative")
+	}
+	return nil
+}
+
+type counters struct {
+	requests atomic.Int64
+	failures atomic.Int64
+}
+
+func main() {
+	logger := log.New(os.Stdout, "sciplayer-simulator ", log.LstdFlags|log.LUTC)
+
+	var cfg config
+	flag.StringVar(&cfg.target, "target", "http://localhost:8090", "base URL of the sciplayer-api server")
+	flag.IntVar(&cfg.devices, "devices", 10, "number of virtual devices")
+	flag.StringVar(&cfg.prefix, "prefix", "sim", "prefix for generated device identifiers")
+	flag.DurationVar(&cfg.pollInterval, "poll-interval", 5*time.Second, "interval between playlist polls per device")
+	flag.IntVar(&cfg.playlists, "playlists", 3, "playlists to attach to each device after registering")
+	flag.DurationVar(&cfg.duration, "duration", 0, "how long to run (0 runs until interrupted)")
+	flag.Parse()
+
+	if err := cfg.validate(); err != nil {
+		logger.Fatalf("invalid flags: %v", err)
+	}
+
+	cfg.target = strings.TrimRight(cfg.target, "/")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if cfg.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.duration)
+		defer cancel()
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	stats := &counters{}
+
+	logger.Printf("starting %d devices against %s", cfg.devices, cfg.target)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.devices; i++ {
+		deviceID := fmt.Sprintf("%s-%04d", cfg.prefix, i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runDevice(ctx, client, cfg, deviceID, stats, logger)
+		}()
+	}
+
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	total := stats.requests.Load()
+	logger.Printf("finished after %s: %d requests, %d failures, %.1f req/s",
+		elapsed.Round(time.Millisecond), total, stats.failures.Load(), float64(total)/elapsed.Seconds())
+}
+
+func runDevice(ctx context.Context, client *http.Client, cfg config, deviceID string, stats *counters, logger *log.Logger) {
+	if err := doJSON(ctx, client, stats, http.MethodPost, cfg.target+"/devices", map[string]string{
+		"deviceId": deviceID,
+	}); err != nil {
+		logger.Printf("%s: register failed: %v", deviceID, err)
+		return
+	}
+
+	playlistsURL := fmt.Sprintf("%s/devices/%s/playlists", cfg.target, deviceID)
+	for i := 0; i < cfg.playlists; i++ {
+		if err := doJSON(ctx, client, stats, http.MethodPost, playlistsURL, map[string]string{
+			"name": fmt.Sprintf("Simulated station %d", i+1),
+			"url":  fmt.Sprintf("https://example.com/%s/%d.m3u8", deviceID, i+1),
+		}); err != nil {
+			logger.Printf("%s: adding playlist failed: %v", deviceID, err)
+		}
+	}
+
+	// Spread the first poll across the interval so devices don't all hit
+	// the server in lockstep.
+	jitter := time.Duration(rand.Int63n(int64(cfg.pollInterval) + 1))
+	timer := time.NewTimer(jitter)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if err := doJSON(ctx, client, stats, http.MethodGet, playlistsURL, nil); err != nil && ctx.Err() == nil {
+			logger.Printf("%s: poll failed: %v", deviceID, err)
+		}
+
+		timer.Reset(cfg.pollInterval)
+	}
+}
+
+func doJSON(ctx context.Context, client *http.Client, stats *counters, method, url string, payload any) error {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("encoding payload: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("building request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	stats.requests.Add(1)
+	resp, err := client.Do(req)
+	if err != nil {
+		stats.failures.Add(1)
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		stats.failures.Add(1)
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
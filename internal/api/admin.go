@@ -0,0 +1,27 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authorizeAdmin reports whether the request carries Config.AdminToken as a
+// bearer token, answering it itself when not. Without a configured token
+// every request is refused, so a forgotten setting never leaves the
+// endpoints open.
+func (a *API) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if a.cfg.AdminToken == "" {
+		a.respondJSON(w, http.StatusForbidden, map[string]string{"error": "admin access is not configured"})
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sciplayer-admin"`)
+		a.respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "admin credentials required"})
+		return false
+	}
+
+	return true
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"io"
@@ -8,41 +9,163 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"sciplayer-api/internal/reqid"
 	"sciplayer-api/internal/store"
 )
 
 type API struct {
-	store  store.Store
-	logger *log.Logger
-	mux    *http.ServeMux
+	store   store.Store
+	logger  *log.Logger
+	mux     *http.ServeMux
+	faults  *faultInjector
+	capture *captureRecorder
+	status  *statusPage
+	limiter *concurrencyLimiter
+	// registrations rate limits POST /devices without a registration token.
+	registrations *registrationLimiter
+	commands      *commandNotifier
+	cfg           Config
+}
+
+// Config holds optional behaviour toggles for the HTTP API.
+type Config struct {
+	// EnableFaultInjection exposes /admin/faults and applies the configured
+	// faults to incoming requests. It must never be enabled in production.
+	EnableFaultInjection bool
+
+	// CaptureDeviceID, when set together with CaptureOutput, records every
+	// request for that device and its response as JSON lines, with
+	// credentials redacted, for later replay.
+	CaptureDeviceID string
+	CaptureOutput   io.Writer
+
+	// NTPServers is returned by /time as guidance for device clock sync.
+	NTPServers []string
+	// ClockDriftThreshold is the offset beyond which /time marks a reported
+	// device clock as drifted.
+	ClockDriftThreshold time.Duration
+
+	// StorageWarningBytes flags /admin/storage once the database grows past
+	// this size. Zero disables the warning.
+	StorageWarningBytes int64
+
+	// MaxInFlightReads and MaxInFlightWrites cap concurrent requests per
+	// route class; excess requests get 503 with RetryAfterSeconds. Zero
+	// leaves a class unlimited.
+	MaxInFlightReads  int
+	MaxInFlightWrites int
+	RetryAfterSeconds int
+
+	// DeviceStaleAfter and DeviceOfflineAfter are how long after its last
+	// heartbeat a device is reported as stale and then offline.
+	DeviceStaleAfter   time.Duration
+	DeviceOfflineAfter time.Duration
+
+	// RequireRegistrationToken rejects POST /devices unless it carries an
+	// unused registration token.
+	RequireRegistrationToken bool
+
+	// OpenRegistrationLimit caps registrations without a token per client
+	// address within OpenRegistrationWindow. Zero leaves them unlimited.
+	OpenRegistrationLimit  int
+	OpenRegistrationWindow time.Duration
+
+	// RegistrationVerifyURL, when set, requires registrations without a
+	// token to carry a verificationToken that the endpoint accepts, using
+	// RegistrationVerifySecret.
+	RegistrationVerifyURL    string
+	RegistrationVerifySecret string
+
+	// AdminToken is the bearer token required for /admin/ and for issuing
+	// registration tokens. When empty, those endpoints refuse every request.
+	AdminToken string
 }
 
 type deviceRequest struct {
-	DeviceID string `json:"deviceId"`
+	DeviceID        string `json:"deviceId"`
+	DisplayName     string `json:"displayName"`
+	Model           string `json:"model"`
+	FirmwareVersion string `json:"firmwareVersion"`
+	// RegistrationToken is a one-time token from POST /registration-tokens.
+	RegistrationToken string `json:"registrationToken"`
+	// VerificationToken is the CAPTCHA or proof-of-work response checked
+	// with Config.RegistrationVerifyURL.
+	VerificationToken string `json:"verificationToken"`
 }
 
 type playlistRequest struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	ArtworkURL string `json:"artworkUrl"`
+}
+
+type playlistPatchRequest struct {
+	Name       *string `json:"name"`
+	URL        *string `json:"url"`
+	ArtworkURL *string `json:"artworkUrl"`
+}
+
+type playlistReorderRequest struct {
+	PlaylistIDs []int64 `json:"playlistIds"`
 }
 
 type playlistResponse struct {
-	Name      string    `json:"name"`
-	URL       string    `json:"url"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID              int64              `json:"id"`
+	Name            string             `json:"name"`
+	URL             string             `json:"url"`
+	ArtworkURL      string             `json:"artworkUrl,omitempty"`
+	ArtworkProxyURL string             `json:"artworkProxyUrl,omitempty"`
+	Position        int                `json:"position"`
+	CreatedAt       time.Time          `json:"createdAt"`
+	UpdatedAt       time.Time          `json:"updatedAt"`
+	DeletedAt       *time.Time         `json:"deletedAt,omitempty"`
+	GroupID         int64              `json:"groupId,omitempty"`
+	LegalHold       *legalHoldResponse `json:"legalHold,omitempty"`
 }
 
-func New(s store.Store, logger *log.Logger) http.Handler {
+func New(s store.Store, logger *log.Logger, cfg Config) http.Handler {
 	if logger == nil {
 		logger = log.New(os.Stdout, "sciplayer-api ", log.LstdFlags|log.LUTC)
 	}
 
 	api := &API{
-		store:  s,
-		logger: logger,
+		store:    s,
+		logger:   logger,
+		status:   &statusPage{startedAt: time.Now()},
+		commands: newCommandNotifier(),
+		cfg:      cfg,
+	}
+	if cfg.MaxInFlightReads > 0 || cfg.MaxInFlightWrites > 0 {
+		retryAfter := cfg.RetryAfterSeconds
+		if retryAfter <= 0 {
+			retryAfter = 1
+		}
+		api.limiter = newConcurrencyLimiter(cfg.MaxInFlightReads, cfg.MaxInFlightWrites, retryAfter)
+	}
+	if cfg.OpenRegistrationLimit > 0 {
+		window := cfg.OpenRegistrationWindow
+		if window <= 0 {
+			window = time.Hour
+		}
+		api.registrations = newRegistrationLimiter(cfg.OpenRegistrationLimit, window)
+	}
+	if cfg.DeviceStaleAfter <= 0 {
+		api.cfg.DeviceStaleAfter = defaultDeviceStaleAfter
+	}
+	if cfg.DeviceOfflineAfter <= 0 {
+		api.cfg.DeviceOfflineAfter = defaultDeviceOfflineAfter
+	}
+
+	if cfg.EnableFaultInjection {
+		api.faults = &faultInjector{}
+	}
+	if cfg.CaptureDeviceID != "" && cfg.CaptureOutput != nil {
+		api.capture = &captureRecorder{deviceID: cfg.CaptureDeviceID, out: cfg.CaptureOutput}
 	}
 	api.mux = api.buildMux()
 
@@ -51,15 +174,68 @@ func New(s store.Store, logger *log.Logger) http.Handler {
 
 func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
-	a.mux.ServeHTTP(w, r)
-	a.logger.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
+
+	// Honour a well-formed X-Request-ID from a proxy or client so traces
+	// line up end to end; otherwise mint one.
+	requestID := r.Header.Get("X-Request-ID")
+	if !reqid.Valid(requestID) {
+		requestID = reqid.New()
+	}
+	w.Header().Set("X-Request-ID", requestID)
+	r = r.WithContext(reqid.NewContext(r.Context(), requestID))
+
+	// Health probes bypass the limiter so a busy server isn't restarted by
+	// its orchestrator.
+	if a.limiter != nil && r.URL.Path != "/healthz" && r.URL.Path != "/status" && !isLongPoll(r) {
+		release, ok := a.limiter.acquire(r)
+		if !ok {
+			a.serviceUnavailable(w, a.limiter.retryAfter)
+			a.logger.Printf("%s %s %s req=%s (shed)", r.Method, r.URL.Path, time.Since(start), requestID)
+			return
+		}
+		defer release()
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/admin/") && !a.authorizeAdmin(w, r) {
+		a.logger.Printf("%s %s %s req=%s (unauthorized)", r.Method, r.URL.Path, time.Since(start), requestID)
+		return
+	}
+
+	if a.faults != nil && !strings.HasPrefix(r.URL.Path, "/admin/") {
+		if handled := a.faults.apply(w, r); handled {
+			a.logger.Printf("%s %s %s req=%s (fault injected)", r.Method, r.URL.Path, time.Since(start), requestID)
+			return
+		}
+	}
+	if a.capture != nil && a.capture.matches(r) {
+		a.serveCaptured(w, r)
+	} else {
+		a.mux.ServeHTTP(w, r)
+	}
+	a.logger.Printf("%s %s %s req=%s", r.Method, r.URL.Path, time.Since(start), requestID)
 }
 
 func (a *API) buildMux() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", a.handleHealthz)
+	mux.HandleFunc("/status", a.handleStatus)
+	mux.HandleFunc("/time", a.handleTime)
+	mux.HandleFunc("/admin/status-banner", a.handleStatusBanner)
+	mux.HandleFunc("/admin/storage", a.handleStorage)
+	mux.HandleFunc("/admin/catalog", a.handleAdminCatalog)
+	mux.HandleFunc("/admin/catalog/", a.handleAdminCatalog)
+	mux.HandleFunc("/admin/import", a.handleAdminImport)
+	mux.HandleFunc("/catalog", a.handleCatalog)
+	mux.HandleFunc("/artwork/", a.handleArtwork)
 	mux.HandleFunc("/devices", a.handleDevices)
 	mux.HandleFunc("/devices/", a.handleDeviceSubroutes)
+	mux.HandleFunc("/registration-tokens", a.handleRegistrationTokens)
+	mux.HandleFunc("/groups", a.handleGroups)
+	mux.HandleFunc("/groups/", a.handleGroupSubroutes)
+
+	if a.faults != nil {
+		mux.HandleFunc("/admin/faults", a.handleFaults)
+	}
 
 	return mux
 }
@@ -78,8 +254,10 @@ func (a *API) handleDevices(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
 		a.createDevice(w, r)
+	case http.MethodGet:
+		a.listDevices(w, r)
 	default:
-		a.methodNotAllowed(w, http.MethodPost)
+		a.methodNotAllowed(w, http.MethodPost, http.MethodGet)
 	}
 }
 
@@ -95,13 +273,130 @@ func (a *API) handleDeviceSubroutes(w http.ResponseWriter, r *http.Request) {
 	deviceID := segments[0]
 
 	if len(segments) == 1 {
-		http.NotFound(w, r)
+		a.handleDevice(w, r, deviceID)
 		return
 	}
 
 	switch segments[1] {
+	case "heartbeat":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handleHeartbeat(w, r, deviceID)
+	case "legal-hold":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handleDeviceLegalHold(w, r, deviceID)
+	case "playback":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handlePlayback(w, r, deviceID)
+	case "playback-events":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handlePlaybackEvents(w, r, deviceID)
+	case "stats":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handlePlaybackStats(w, r, deviceID)
+	case "sessions":
+		switch {
+		case len(segments) == 2:
+			a.handlePlaybackSessions(w, r, deviceID)
+		case len(segments) == 4 && segments[3] == "close":
+			a.handlePlaybackSessionClose(w, r, deviceID, segments[2])
+		default:
+			http.NotFound(w, r)
+		}
+	case "commands":
+		switch {
+		case len(segments) == 2:
+			a.handleCommands(w, r, deviceID)
+		case len(segments) == 3:
+			a.handleCommand(w, r, deviceID, segments[2])
+		case len(segments) == 4 && segments[3] == "ack":
+			a.handleCommandAck(w, r, deviceID, segments[2])
+		default:
+			http.NotFound(w, r)
+		}
+	case "settings":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handleDeviceSettings(w, r, deviceID)
+	case "now-playing":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handleNowPlaying(w, r, deviceID)
+	case "unarchive":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handleDeviceUnarchive(w, r, deviceID)
+	case "rename":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handleDeviceRename(w, r, deviceID)
+	case "playlists:batch":
+		if len(segments) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		a.handlePlaylistBatch(w, r, deviceID)
+	case "playlists:install":
+		if len(segments) != 3 || segments[2] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		a.handleCatalogInstall(w, r, deviceID, segments[2])
+	case "playlists:copy-from":
+		if len(segments) != 3 || segments[2] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		a.handlePlaylistCopy(w, r, deviceID, segments[2])
 	case "playlists":
-		a.handlePlaylists(w, r, deviceID)
+		switch {
+		case len(segments) == 2:
+			a.handlePlaylists(w, r, deviceID)
+		case len(segments) == 3 && segments[2] == "reorder":
+			a.handlePlaylistReorder(w, r, deviceID)
+		case len(segments) == 3 && segments[2] == "trash":
+			a.handlePlaylistTrash(w, r, deviceID)
+		case len(segments) == 3:
+			a.handlePlaylist(w, r, deviceID, segments[2])
+		case len(segments) == 4 && segments[3] == "restore":
+			a.handlePlaylistRestore(w, r, deviceID, segments[2])
+		case len(segments) == 4 && segments[3] == "legal-hold":
+			a.handlePlaylistLegalHold(w, r, deviceID, segments[2])
+		case len(segments) == 4 && segments[3] == "expand":
+			a.handlePlaylistExpand(w, r, deviceID, segments[2])
+		case len(segments) == 4 && segments[3] == "tracks":
+			a.handleTracks(w, r, deviceID, segments[2])
+		case len(segments) == 5 && segments[3] == "tracks" && segments[4] == "reorder":
+			a.handleTrackReorder(w, r, deviceID, segments[2])
+		case len(segments) == 5 && segments[3] == "tracks":
+			a.handleTrack(w, r, deviceID, segments[2], segments[4])
+		case len(segments) == 6 && segments[3] == "tracks" && segments[5] == "feedback":
+			a.handleTrackFeedback(w, r, deviceID, segments[2], segments[4])
+		default:
+			http.NotFound(w, r)
+		}
 	default:
 		http.NotFound(w, r)
 	}
@@ -127,7 +422,28 @@ func (a *API) createDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	created, err := a.store.CreateDevice(r.Context(), req.DeviceID)
+	meta := store.DeviceMetadata{
+		DisplayName:     strings.TrimSpace(req.DisplayName),
+		Model:           strings.TrimSpace(req.Model),
+		FirmwareVersion: strings.TrimSpace(req.FirmwareVersion),
+	}
+
+	req.RegistrationToken = strings.TrimSpace(req.RegistrationToken)
+	if req.RegistrationToken != "" {
+		a.registerDevice(w, r, req.DeviceID, req.RegistrationToken, meta)
+		return
+	}
+
+	if a.cfg.RequireRegistrationToken {
+		a.respondJSON(w, http.StatusForbidden, map[string]string{"error": "registrationToken is required"})
+		return
+	}
+
+	if !a.guardOpenRegistration(w, r, strings.TrimSpace(req.VerificationToken)) {
+		return
+	}
+
+	created, err := a.store.CreateDevice(r.Context(), req.DeviceID, meta)
 	if err != nil {
 		a.internalServerError(w, err)
 		return
@@ -169,25 +485,53 @@ func (a *API) addPlaylist(w http.ResponseWriter, r *http.Request, deviceID strin
 		return
 	}
 
-	req.Name = strings.TrimSpace(req.Name)
-	req.URL = strings.TrimSpace(req.URL)
-
-	if req.Name == "" {
-		a.badRequest(w, "name is required")
+	if err := normalizePlaylistRequest(&req); err != nil {
+		a.badRequest(w, err.Error())
 		return
 	}
 
-	if req.URL == "" {
-		a.badRequest(w, "url is required")
+	playlist, err := a.store.AddPlaylist(r.Context(), deviceID, store.NewPlaylist{
+		Name:       req.Name,
+		URL:        req.URL,
+		ArtworkURL: req.ArtworkURL,
+	})
+	if err != nil {
+		var duplicate *store.DuplicatePlaylistError
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.As(err, &duplicate):
+			a.duplicatePlaylist(w, duplicate)
+		case errors.Is(err, store.ErrPlaylistQuota):
+			a.unprocessableEntity(w, err.Error())
+		default:
+			a.internalServerError(w, err)
+		}
 		return
 	}
 
-	if err := validateURL(req.URL); err != nil {
-		a.badRequest(w, "url must be a valid absolute URL")
-		return
+	resp := map[string]any{
+		"deviceId":  deviceID,
+		"id":        playlist.ID,
+		"name":      playlist.Name,
+		"url":       playlist.URL,
+		"position":  playlist.Position,
+		"createdAt": playlist.CreatedAt,
+	}
+	if playlist.ArtworkURL != "" {
+		resp["artworkUrl"] = playlist.ArtworkURL
+		resp["artworkProxyUrl"] = artworkProxyPath(playlist.ArtworkURL)
 	}
 
-	if err := a.store.AddPlaylist(r.Context(), deviceID, req.Name, req.URL); err != nil {
+	a.respondJSON(w, http.StatusCreated, resp)
+}
+
+// listPlaylists returns the device's own playlists followed by those it
+// inherits from its groups, or all of them sorted when the device uses a
+// computed playlist order.
+func (a *API) listPlaylists(w http.ResponseWriter, r *http.Request, deviceID string) {
+	device, err := a.store.GetDevice(r.Context(), deviceID)
+	if err != nil {
 		if errors.Is(err, store.ErrDeviceNotFound) {
 			http.Error(w, "device not found", http.StatusNotFound)
 			return
@@ -196,14 +540,6 @@ func (a *API) addPlaylist(w http.ResponseWriter, r *http.Request, deviceID strin
 		return
 	}
 
-	a.respondJSON(w, http.StatusCreated, map[string]string{
-		"deviceId": deviceID,
-		"name":     req.Name,
-		"url":      req.URL,
-	})
-}
-
-func (a *API) listPlaylists(w http.ResponseWriter, r *http.Request, deviceID string) {
 	playlists, err := a.store.ListPlaylists(r.Context(), deviceID)
 	if err != nil {
 		if errors.Is(err, store.ErrDeviceNotFound) {
@@ -214,18 +550,251 @@ func (a *API) listPlaylists(w http.ResponseWriter, r *http.Request, deviceID str
 		return
 	}
 
+	inherited, err := a.store.ListInheritedPlaylists(r.Context(), deviceID)
+	if err != nil {
+		if errors.Is(err, store.ErrDeviceNotFound) {
+			http.Error(w, "device not found", http.StatusNotFound)
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	playlists = append(playlists, inherited...)
+	sortPlaylists(playlists, device.PlaylistOrder)
+
 	resp := make([]playlistResponse, 0, len(playlists))
 	for _, pl := range playlists {
-		resp = append(resp, playlistResponse{
-			Name:      pl.Name,
-			URL:       pl.URL,
-			CreatedAt: pl.CreatedAt,
-		})
+		resp = append(resp, newPlaylistResponse(pl))
 	}
 
 	a.respondJSON(w, http.StatusOK, resp)
 }
 
+func (a *API) handlePlaylistReorder(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req playlistReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if err := a.store.ReorderPlaylists(r.Context(), deviceID, req.PlaylistIDs); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrInvalidPlaylistOrder), errors.Is(err, store.ErrPlaylistNotFound):
+			a.badRequest(w, "playlistIds must list every playlist of the device exactly once")
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	a.listPlaylists(w, r, deviceID)
+}
+
+func (a *API) handlePlaylist(w http.ResponseWriter, r *http.Request, deviceID, rawPlaylistID string) {
+	playlistID, err := parsePlaylistID(rawPlaylistID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.getPlaylist(w, r, deviceID, playlistID)
+	case http.MethodPut:
+		a.replacePlaylist(w, r, deviceID, playlistID)
+	case http.MethodPatch:
+		a.patchPlaylist(w, r, deviceID, playlistID)
+	case http.MethodDelete:
+		a.deletePlaylist(w, r, deviceID, playlistID)
+	default:
+		a.methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+func (a *API) getPlaylist(w http.ResponseWriter, r *http.Request, deviceID string, playlistID int64) {
+	playlist, err := a.store.GetPlaylist(r.Context(), deviceID, playlistID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrPlaylistNotFound):
+			http.Error(w, "playlist not found", http.StatusNotFound)
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, newPlaylistResponse(playlist))
+}
+
+func (a *API) replacePlaylist(w http.ResponseWriter, r *http.Request, deviceID string, playlistID int64) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req playlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if err := normalizePlaylistRequest(&req); err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	a.updatePlaylist(w, r, deviceID, playlistID, store.PlaylistUpdate{
+		Name:       &req.Name,
+		URL:        &req.URL,
+		ArtworkURL: &req.ArtworkURL,
+	})
+}
+
+func (a *API) patchPlaylist(w http.ResponseWriter, r *http.Request, deviceID string, playlistID int64) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req playlistPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if req.Name == nil && req.URL == nil && req.ArtworkURL == nil {
+		a.badRequest(w, "at least one of name, url or artworkUrl is required")
+		return
+	}
+
+	if req.Name != nil {
+		*req.Name = strings.TrimSpace(*req.Name)
+		if *req.Name == "" {
+			a.badRequest(w, "name must not be empty")
+			return
+		}
+	}
+
+	if req.URL != nil {
+		*req.URL = strings.TrimSpace(*req.URL)
+		if err := validateURL(*req.URL); err != nil {
+			a.badRequest(w, "url must be a valid absolute URL")
+			return
+		}
+	}
+
+	if req.ArtworkURL != nil {
+		*req.ArtworkURL = strings.TrimSpace(*req.ArtworkURL)
+		if err := validateArtworkURL(*req.ArtworkURL); err != nil {
+			a.badRequest(w, err.Error())
+			return
+		}
+	}
+
+	a.updatePlaylist(w, r, deviceID, playlistID, store.PlaylistUpdate{
+		Name:       req.Name,
+		URL:        req.URL,
+		ArtworkURL: req.ArtworkURL,
+	})
+}
+
+func (a *API) updatePlaylist(w http.ResponseWriter, r *http.Request, deviceID string, playlistID int64, update store.PlaylistUpdate) {
+	playlist, err := a.store.UpdatePlaylist(r.Context(), deviceID, playlistID, update)
+	if err != nil {
+		var duplicate *store.DuplicatePlaylistError
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrPlaylistNotFound):
+			http.Error(w, "playlist not found", http.StatusNotFound)
+		case errors.As(err, &duplicate):
+			a.duplicatePlaylist(w, duplicate)
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, newPlaylistResponse(playlist))
+}
+
+// deletePlaylist moves the playlist to the trash, or removes it for good
+// when called with ?permanent=true.
+func (a *API) deletePlaylist(w http.ResponseWriter, r *http.Request, deviceID string, playlistID int64) {
+	remove := a.store.DeletePlaylist
+	if r.URL.Query().Get("permanent") == "true" {
+		remove = a.store.PurgePlaylist
+	}
+
+	if err := remove(r.Context(), deviceID, playlistID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrPlaylistNotFound):
+			http.Error(w, "playlist not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrLegalHold):
+			a.respondJSON(w, http.StatusConflict, map[string]string{"error": "playlist or its device is under legal hold"})
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sortPlaylists applies a computed order in place. Manual order is the
+// stored position and leaves the list as it is.
+func sortPlaylists(playlists []store.Playlist, order store.PlaylistOrder) {
+	switch order {
+	case store.OrderAlphabetical:
+		slices.SortStableFunc(playlists, func(a, b store.Playlist) int {
+			return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		})
+	case store.OrderNewest:
+		slices.SortStableFunc(playlists, func(a, b store.Playlist) int {
+			return b.CreatedAt.Compare(a.CreatedAt)
+		})
+	}
+}
+
+func newPlaylistResponse(pl store.Playlist) playlistResponse {
+	return playlistResponse{
+		ID:              pl.ID,
+		Name:            pl.Name,
+		URL:             pl.URL,
+		ArtworkURL:      pl.ArtworkURL,
+		ArtworkProxyURL: artworkProxyPath(pl.ArtworkURL),
+		Position:        pl.Position,
+		CreatedAt:       pl.CreatedAt,
+		UpdatedAt:       pl.UpdatedAt,
+		DeletedAt:       pl.DeletedAt,
+		GroupID:         pl.GroupID,
+		LegalHold:       newLegalHoldResponse(pl.LegalHold),
+	}
+}
+
 func (a *API) respondJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -238,9 +807,20 @@ func (a *API) badRequest(w http.ResponseWriter, message string) {
 	a.respondJSON(w, http.StatusBadRequest, map[string]string{"error": message})
 }
 
+func (a *API) unprocessableEntity(w http.ResponseWriter, message string) {
+	a.respondJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": message})
+}
+
 func (a *API) internalServerError(w http.ResponseWriter, err error) {
 	a.respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
-	a.logger.Printf("internal error: %v", err)
+	a.logger.Printf("internal error req=%s: %v", w.Header().Get("X-Request-ID"), err)
+}
+
+func (a *API) duplicatePlaylist(w http.ResponseWriter, duplicate *store.DuplicatePlaylistError) {
+	a.respondJSON(w, http.StatusConflict, map[string]any{
+		"error":    "playlist already exists",
+		"playlist": newPlaylistResponse(duplicate.Existing),
+	})
 }
 
 func (a *API) methodNotAllowed(w http.ResponseWriter, allowedMethods ...string) {
@@ -248,6 +828,39 @@ func (a *API) methodNotAllowed(w http.ResponseWriter, allowedMethods ...string)
 	a.respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
 }
 
+// normalizePlaylistRequest trims the request fields and reports the first
+// validation failure as a client-facing message.
+func normalizePlaylistRequest(req *playlistRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.URL = strings.TrimSpace(req.URL)
+	req.ArtworkURL = strings.TrimSpace(req.ArtworkURL)
+
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if req.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if err := validateURL(req.URL); err != nil {
+		return errors.New("url must be a valid absolute URL")
+	}
+
+	return validateArtworkURL(req.ArtworkURL)
+}
+
+func parsePlaylistID(raw string) (int64, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, errors.New("playlist id must be positive")
+	}
+	return id, nil
+}
+
 func validateURL(raw string) error {
 	parsed, err := url.Parse(raw)
 	if err != nil {
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const (
+	artworkFetchTimeout = 15 * time.Second
+	artworkCacheTTL     = 24 * time.Hour
+	maxArtworkBytes     = 5 << 20
+)
+
+var artworkClient = newRestrictedClient(artworkFetchTimeout)
+
+// handleArtwork serves a playlist or track image from the local cache,
+// fetching it from its upstream URL on the first request and again once the
+// cached copy is older than artworkCacheTTL. A stale copy is served when the
+// refresh fails.
+func (a *API) handleArtwork(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		a.methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	artworkID := strings.TrimPrefix(r.URL.Path, "/artwork/")
+	if _, err := hex.DecodeString(artworkID); err != nil || len(artworkID) != 32 {
+		http.NotFound(w, r)
+		return
+	}
+
+	cached, err := a.store.GetArtwork(r.Context(), artworkID)
+	switch {
+	case err == nil:
+		if time.Since(cached.FetchedAt) < artworkCacheTTL {
+			writeArtwork(w, r, cached)
+			return
+		}
+	case !errors.Is(err, store.ErrArtworkNotFound):
+		a.internalServerError(w, err)
+		return
+	}
+
+	artworkURL := cached.URL
+	if artworkURL == "" {
+		if artworkURL, err = a.store.FindArtworkURL(r.Context(), artworkID); err != nil {
+			if errors.Is(err, store.ErrArtworkNotFound) {
+				http.Error(w, "artwork not found", http.StatusNotFound)
+				return
+			}
+			a.internalServerError(w, err)
+			return
+		}
+	}
+
+	// The server's write timeout is shorter than a slow upstream fetch.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(artworkFetchTimeout + 5*time.Second)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		a.internalServerError(w, err)
+		return
+	}
+
+	fetched, err := fetchArtwork(r, artworkURL)
+	if err != nil {
+		a.logger.Printf("fetching artwork %s: %v", artworkID, err)
+		if cached.URL != "" {
+			writeArtwork(w, r, cached)
+			return
+		}
+		a.respondJSON(w, http.StatusBadGateway, map[string]string{"error": "could not fetch artwork"})
+		return
+	}
+
+	fetched.ID = artworkID
+	if err := a.store.SaveArtwork(r.Context(), fetched); err != nil {
+		a.logger.Printf("caching artwork %s: %v", artworkID, err)
+	}
+
+	writeArtwork(w, r, fetched)
+}
+
+// fetchArtwork downloads an image. Responses that are not images, as declared
+// or as sniffed when no type is given, are rejected.
+func fetchArtwork(r *http.Request, artworkURL string) (store.Artwork, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, artworkURL, nil)
+	if err != nil {
+		return store.Artwork{}, fmt.Errorf("building request: %w", err)
+	}
+
+	resp, err := artworkClient.Do(req)
+	if err != nil {
+		return store.Artwork{}, fmt.Errorf("fetching artwork: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return store.Artwork{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxArtworkBytes+1))
+	if err != nil {
+		return store.Artwork{}, fmt.Errorf("reading artwork: %w", err)
+	}
+	if len(data) > maxArtworkBytes {
+		return store.Artwork{}, fmt.Errorf("artwork exceeds %d bytes", maxArtworkBytes)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return store.Artwork{}, fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	return store.Artwork{
+		URL:         artworkURL,
+		ContentType: mediaType,
+		Data:        data,
+		FetchedAt:   time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+func writeArtwork(w http.ResponseWriter, r *http.Request, artwork store.Artwork) {
+	w.Header().Set("Content-Type", artwork.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(artwork.Data)))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(artworkCacheTTL.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(artwork.Data)
+}
+
+// artworkProxyPath is the path under which devices fetch an artwork URL
+// through this server, or empty when no artwork is set.
+func artworkProxyPath(artworkURL string) string {
+	if artworkURL == "" {
+		return ""
+	}
+	return "/artwork/" + store.ArtworkID(artworkURL)
+}
+
+// validateArtworkURL accepts an empty value, which clears the artwork.
+func validateArtworkURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return errors.New("artworkUrl must be an absolute http or https URL")
+	}
+
+	return nil
+}
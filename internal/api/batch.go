@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"sciplayer-api/internal/store"
+)
+
+const maxPlaylistBatchSize = 100
+
+type playlistBatchResult struct {
+	Index    int               `json:"index"`
+	Status   int               `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Playlist *playlistResponse `json:"playlist,omitempty"`
+}
+
+// handlePlaylistBatch creates several playlists in one transaction. Items
+// that fail validation or the uniqueness rule are reported individually and
+// do not prevent the rest of the batch from being stored.
+func (a *API) handlePlaylistBatch(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req []playlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if len(req) == 0 {
+		a.badRequest(w, "at least one playlist is required")
+		return
+	}
+
+	if len(req) > maxPlaylistBatchSize {
+		a.badRequest(w, fmt.Sprintf("at most %d playlists can be created per batch", maxPlaylistBatchSize))
+		return
+	}
+
+	results := make([]playlistBatchResult, len(req))
+	valid := make([]store.NewPlaylist, 0, len(req))
+	validIndexes := make([]int, 0, len(req))
+
+	for i := range req {
+		results[i].Index = i
+		if err := normalizePlaylistRequest(&req[i]); err != nil {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = err.Error()
+			continue
+		}
+		valid = append(valid, store.NewPlaylist{Name: req[i].Name, URL: req[i].URL, ArtworkURL: req[i].ArtworkURL})
+		validIndexes = append(validIndexes, i)
+	}
+
+	if len(valid) > 0 {
+		stored, err := a.store.AddPlaylists(r.Context(), deviceID, valid)
+		if err != nil {
+			if errors.Is(err, store.ErrDeviceNotFound) {
+				http.Error(w, "device not found", http.StatusNotFound)
+				return
+			}
+			a.internalServerError(w, err)
+			return
+		}
+
+		for j, res := range stored {
+			result := &results[validIndexes[j]]
+
+			var duplicate *store.DuplicatePlaylistError
+			if errors.As(res.Err, &duplicate) {
+				existing := newPlaylistResponse(duplicate.Existing)
+				result.Status = http.StatusConflict
+				result.Error = "playlist already exists"
+				result.Playlist = &existing
+				continue
+			}
+
+			if errors.Is(res.Err, store.ErrPlaylistQuota) {
+				result.Status = http.StatusUnprocessableEntity
+				result.Error = res.Err.Error()
+				continue
+			}
+
+			created := newPlaylistResponse(res.Playlist)
+			result.Status = http.StatusCreated
+			result.Playlist = &created
+		}
+	}
+
+	a.respondJSON(w, http.StatusOK, map[string]any{
+		"deviceId": deviceID,
+		"results":  results,
+	})
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redacted = "[redacted]"
+
+// BodyEncodingBase64 marks a captured body that was not JSON and is stored
+// as a base64 string of its raw bytes.
+const BodyEncodingBase64 = "base64"
+
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+var sensitiveFields = []string{"password", "secret", "token"}
+
+// CapturedExchange is a single request/response pair written by capture mode.
+// The replay tool reads the same format back. Bodies are stored as JSON, or
+// base64-encoded when their encoding says so. RequestRedacted is set when
+// credentials were masked in the request body, so replaying it cannot
+// reproduce the captured status.
+type CapturedExchange struct {
+	Time                 time.Time         `json:"time"`
+	Method               string            `json:"method"`
+	Path                 string            `json:"path"`
+	Query                string            `json:"query,omitempty"`
+	RequestHeaders       map[string]string `json:"requestHeaders,omitempty"`
+	RequestBody          json.RawMessage   `json:"requestBody,omitempty"`
+	RequestBodyEncoding  string            `json:"requestBodyEncoding,omitempty"`
+	RequestRedacted      bool              `json:"requestRedacted,omitempty"`
+	Status               int               `json:"status"`
+	ResponseBody         json.RawMessage   `json:"responseBody,omitempty"`
+	ResponseBodyEncoding string            `json:"responseBodyEncoding,omitempty"`
+	DurationSeconds      float64           `json:"durationSeconds"`
+}
+
+// RequestPayload returns the request body as it is to be sent again.
+func (e CapturedExchange) RequestPayload() ([]byte, error) {
+	if e.RequestBodyEncoding != BodyEncodingBase64 {
+		return e.RequestBody, nil
+	}
+
+	var encoded []byte
+	if err := json.Unmarshal(e.RequestBody, &encoded); err != nil {
+		return nil, fmt.Errorf("decoding %s request body: %w", e.RequestBodyEncoding, err)
+	}
+	return encoded, nil
+}
+
+type captureRecorder struct {
+	deviceID string
+	mu       sync.Mutex
+	out      io.Writer
+}
+
+// matches reports whether the request belongs to the captured device. The
+// registration call carries the identifier in its body, so that body is
+// peeked at and restored for the handler.
+func (c *captureRecorder) matches(r *http.Request) bool {
+	prefix := "/devices/" + c.deviceID
+	if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+		return true
+	}
+
+	if r.URL.Path != "/devices" || r.Method != http.MethodPost || r.Body == nil {
+		return false
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var req deviceRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return false
+	}
+	return strings.TrimSpace(req.DeviceID) == c.deviceID
+}
+
+func (c *captureRecorder) write(exchange CapturedExchange) error {
+	encoded, err := json.Marshal(exchange)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.out.Write(append(encoded, '\n'))
+	return err
+}
+
+// captureWriter tees the response body so it can be recorded after the
+// handler returns.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (a *API) serveCaptured(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var requestBody []byte
+	if r.Body != nil {
+		var err error
+		requestBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			a.badRequest(w, "unable to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	cw := &captureWriter{ResponseWriter: w}
+	a.mux.ServeHTTP(cw, r)
+
+	headers := make(map[string]string, len(r.Header))
+	for key := range r.Header {
+		headers[key] = r.Header.Get(key)
+	}
+	for _, key := range sensitiveHeaders {
+		if _, ok := headers[key]; ok {
+			headers[key] = redacted
+		}
+	}
+
+	exchange := CapturedExchange{
+		Time:            start.UTC(),
+		Method:          r.Method,
+		Path:            r.URL.Path,
+		Query:           r.URL.RawQuery,
+		RequestHeaders:  headers,
+		Status:          cw.status,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	exchange.RequestBody, exchange.RequestBodyEncoding, exchange.RequestRedacted = captureBody(requestBody)
+	exchange.ResponseBody, exchange.ResponseBodyEncoding, _ = captureBody(cw.body.Bytes())
+
+	if err := a.capture.write(exchange); err != nil {
+		a.logger.Printf("failed to write capture: %v", err)
+	}
+}
+
+// captureBody prepares a body for the capture file and reports its encoding.
+// JSON bodies are stored with sensitive fields masked, reporting whether any
+// were. Other bodies are stored base64-encoded so they replay byte for byte.
+func captureBody(body []byte) (json.RawMessage, string, bool) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, "", false
+	}
+
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		encoded, _ := json.Marshal(body)
+		return encoded, BodyEncodingBase64, false
+	}
+
+	masked, found := redactValue(decoded)
+	encoded, err := json.Marshal(masked)
+	if err != nil {
+		return nil, "", false
+	}
+	return encoded, "", found
+}
+
+// redactValue masks sensitive fields at any depth and reports whether it
+// found one.
+func redactValue(value any) (any, bool) {
+	found := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, inner := range v {
+			if isSensitiveField(key) {
+				v[key] = redacted
+				found = true
+				continue
+			}
+			masked, innerFound := redactValue(inner)
+			v[key] = masked
+			found = found || innerFound
+		}
+	case []any:
+		for i, inner := range v {
+			masked, innerFound := redactValue(inner)
+			v[i] = masked
+			found = found || innerFound
+		}
+	}
+	return value, found
+}
+
+func isSensitiveField(key string) bool {
+	lower := strings.ToLower(key)
+	for _, field := range sensitiveFields {
+		if strings.Contains(lower, field) {
+			return true
+		}
+	}
+	return false
+}
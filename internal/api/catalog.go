@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+type catalogEntryRequest struct {
+	playlistRequest
+	Description string `json:"description"`
+}
+
+type catalogEntryResponse struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	URL             string    `json:"url"`
+	ArtworkURL      string    `json:"artworkUrl,omitempty"`
+	ArtworkProxyURL string    `json:"artworkProxyUrl,omitempty"`
+	Description     string    `json:"description"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// handleCatalog lists the curated playlists any device can install.
+func (a *API) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	entries, err := a.store.ListCatalog(r.Context())
+	if err != nil {
+		a.internalServerError(w, err)
+		return
+	}
+
+	resp := make([]catalogEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		resp = append(resp, newCatalogEntryResponse(entry))
+	}
+
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+// handleAdminCatalog publishes catalog entries (POST /admin/catalog) and
+// withdraws them (DELETE /admin/catalog/{id}).
+func (a *API) handleAdminCatalog(w http.ResponseWriter, r *http.Request) {
+	rawID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/catalog"), "/")
+
+	if rawID == "" {
+		if r.Method != http.MethodPost {
+			a.methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		a.addCatalogEntry(w, r)
+		return
+	}
+
+	entryID, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil || entryID <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		a.methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+
+	if err := a.store.DeleteCatalogEntry(r.Context(), entryID); err != nil {
+		if errors.Is(err, store.ErrCatalogNotFound) {
+			http.Error(w, "catalog entry not found", http.StatusNotFound)
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) addCatalogEntry(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req catalogEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if err := normalizePlaylistRequest(&req.playlistRequest); err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	entry, err := a.store.AddCatalogEntry(r.Context(), store.NewPlaylist{
+		Name:       req.Name,
+		URL:        req.URL,
+		ArtworkURL: req.ArtworkURL,
+	}, strings.TrimSpace(req.Description))
+	if err != nil {
+		a.internalServerError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusCreated, newCatalogEntryResponse(entry))
+}
+
+// handleCatalogInstall adds a catalog entry to the device's playlists.
+func (a *API) handleCatalogInstall(w http.ResponseWriter, r *http.Request, deviceID, rawEntryID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	entryID, err := strconv.ParseInt(rawEntryID, 10, 64)
+	if err != nil || entryID <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	playlist, err := a.store.InstallCatalogEntry(r.Context(), deviceID, entryID)
+	if err != nil {
+		var duplicate *store.DuplicatePlaylistError
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrCatalogNotFound):
+			http.Error(w, "catalog entry not found", http.StatusNotFound)
+		case errors.As(err, &duplicate):
+			a.duplicatePlaylist(w, duplicate)
+		case errors.Is(err, store.ErrPlaylistQuota):
+			a.unprocessableEntity(w, err.Error())
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	a.respondJSON(w, http.StatusCreated, newPlaylistResponse(playlist))
+}
+
+func newCatalogEntryResponse(entry store.CatalogEntry) catalogEntryResponse {
+	return catalogEntryResponse{
+		ID:              entry.ID,
+		Name:            entry.Name,
+		URL:             entry.URL,
+		ArtworkURL:      entry.ArtworkURL,
+		ArtworkProxyURL: artworkProxyPath(entry.ArtworkURL),
+		Description:     entry.Description,
+		CreatedAt:       entry.CreatedAt,
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+type timeResponse struct {
+	ServerTime  time.Time        `json:"serverTime"`
+	UnixMillis  int64            `json:"unixMillis"`
+	NTPServers  []string         `json:"ntpServers"`
+	ClientClock *clientClockInfo `json:"clientClock,omitempty"`
+}
+
+type clientClockInfo struct {
+	ReportedTime time.Time `json:"reportedTime"`
+	OffsetMs     int64     `json:"offsetMs"`
+	Drifted      bool      `json:"drifted"`
+}
+
+// handleTime returns the server clock with nanosecond precision. Devices may
+// pass their own clock as ?clientTime=<RFC3339> to learn their offset and
+// whether it exceeds the configured drift threshold.
+func (a *API) handleTime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	now := time.Now().UTC()
+
+	ntpServers := a.cfg.NTPServers
+	if ntpServers == nil {
+		ntpServers = []string{}
+	}
+
+	resp := timeResponse{
+		ServerTime: now,
+		UnixMillis: now.UnixMilli(),
+		NTPServers: ntpServers,
+	}
+
+	if raw := r.URL.Query().Get("clientTime"); raw != "" {
+		reported, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			a.badRequest(w, "clientTime must be an RFC3339 timestamp")
+			return
+		}
+
+		offset := reported.Sub(now)
+		resp.ClientClock = &clientClockInfo{
+			ReportedTime: reported.UTC(),
+			OffsetMs:     offset.Milliseconds(),
+			Drifted:      a.cfg.ClockDriftThreshold > 0 && offset.Abs() > a.cfg.ClockDriftThreshold,
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	a.respondJSON(w, http.StatusOK, resp)
+}
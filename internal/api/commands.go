@@ -0,0 +1,370 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const (
+	defaultCommandTTL = 5 * time.Minute
+	maxCommandTTL     = time.Hour
+	maxCommandWait    = 60 * time.Second
+	maxCommandError   = 500
+)
+
+type commandRequest struct {
+	Type       string `json:"type"`
+	Volume     *int   `json:"volume"`
+	PlaylistID *int64 `json:"playlistId"`
+	TTLSeconds int    `json:"ttlSeconds"`
+}
+
+type commandAckRequest struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+type commandResponse struct {
+	ID             int64      `json:"id"`
+	Type           string     `json:"type"`
+	Volume         *int       `json:"volume,omitempty"`
+	PlaylistID     *int64     `json:"playlistId,omitempty"`
+	Status         string     `json:"status"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt"`
+	CompletedAt    *time.Time `json:"completedAt"`
+}
+
+// commandNotifier wakes long-polling devices when a command is queued for
+// them. Polls of the same device share one channel, closed and dropped on
+// notify; the last poll to give up on it without being woken drops it too.
+type commandNotifier struct {
+	mu      sync.Mutex
+	waiters map[string]*commandWaiter
+}
+
+type commandWaiter struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newCommandNotifier() *commandNotifier {
+	return &commandNotifier{waiters: make(map[string]*commandWaiter)}
+}
+
+// wait returns a channel that is closed the next time notify is called for
+// the device, and a release func the caller must call once it stops
+// waiting. Callers must take the channel before checking the queue so a
+// command queued in between is not missed.
+func (n *commandNotifier) wait(deviceID string) (<-chan struct{}, func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	w, ok := n.waiters[deviceID]
+	if !ok {
+		w = &commandWaiter{ch: make(chan struct{})}
+		n.waiters[deviceID] = w
+	}
+	w.refs++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+
+			w.refs--
+			if w.refs == 0 && n.waiters[deviceID] == w {
+				delete(n.waiters, deviceID)
+			}
+		})
+	}
+
+	return w.ch, release
+}
+
+func (n *commandNotifier) notify(deviceID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if w, ok := n.waiters[deviceID]; ok {
+		close(w.ch)
+		delete(n.waiters, deviceID)
+	}
+}
+
+// handleCommands queues remote-control commands from the app and hands them
+// to the device, which long-polls with ?wait=.
+func (a *API) handleCommands(w http.ResponseWriter, r *http.Request, deviceID string) {
+	switch r.Method {
+	case http.MethodPost:
+		a.enqueueCommand(w, r, deviceID)
+	case http.MethodGet:
+		a.pollCommands(w, r, deviceID)
+	default:
+		a.methodNotAllowed(w, http.MethodPost, http.MethodGet)
+	}
+}
+
+func (a *API) enqueueCommand(w http.ResponseWriter, r *http.Request, deviceID string) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req commandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	cmdType, err := store.ParseCommandType(strings.TrimSpace(req.Type))
+	if err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	switch {
+	case cmdType == store.CommandVolume && req.Volume == nil:
+		a.badRequest(w, "volume is required for volume commands")
+		return
+	case cmdType == store.CommandVolume && (*req.Volume < 0 || *req.Volume > 100):
+		a.badRequest(w, "volume must be between 0 and 100")
+		return
+	case cmdType != store.CommandVolume && req.Volume != nil:
+		a.badRequest(w, "volume is only valid for volume commands")
+		return
+	case cmdType == store.CommandSwitchPlaylist && req.PlaylistID == nil:
+		a.badRequest(w, "playlistId is required for switch-playlist commands")
+		return
+	case cmdType != store.CommandSwitchPlaylist && req.PlaylistID != nil:
+		a.badRequest(w, "playlistId is only valid for switch-playlist commands")
+		return
+	}
+
+	ttl := defaultCommandTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+		if ttl <= 0 || ttl > maxCommandTTL {
+			a.badRequest(w, fmt.Sprintf("ttlSeconds must be between 1 and %d", int(maxCommandTTL.Seconds())))
+			return
+		}
+	}
+
+	cmd, err := a.store.EnqueueCommand(r.Context(), deviceID, store.NewCommand{
+		Type:       cmdType,
+		Volume:     req.Volume,
+		PlaylistID: req.PlaylistID,
+		ExpiresAt:  time.Now().Add(ttl),
+	})
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	a.commands.notify(deviceID)
+	a.respondJSON(w, http.StatusCreated, newCommandResponse(cmd, time.Now()))
+}
+
+func (a *API) pollCommands(w http.ResponseWriter, r *http.Request, deviceID string) {
+	var wait time.Duration
+	if raw := r.URL.Query().Get("wait"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < 0 || parsed > maxCommandWait {
+			a.badRequest(w, fmt.Sprintf("wait must be a duration between 0s and %s", maxCommandWait))
+			return
+		}
+		wait = parsed
+	}
+
+	// The first check also confirms the device exists, so polls for unknown
+	// devices never register a waiter.
+	commands, err := a.store.PendingCommands(r.Context(), deviceID, time.Now())
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	if len(commands) == 0 && wait > 0 {
+		woken, release := a.commands.wait(deviceID)
+		defer release()
+
+		// A command queued before the waiter was registered would not wake it.
+		if commands, err = a.store.PendingCommands(r.Context(), deviceID, time.Now()); err != nil {
+			a.trackError(w, err)
+			return
+		}
+		if len(commands) > 0 {
+			a.respondCommands(w, commands)
+			return
+		}
+
+		// The server's write timeout is shorter than a long poll.
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Now().Add(wait + 5*time.Second)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			a.internalServerError(w, err)
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-woken:
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+
+		if commands, err = a.store.PendingCommands(r.Context(), deviceID, time.Now()); err != nil {
+			a.trackError(w, err)
+			return
+		}
+	}
+
+	a.respondCommands(w, commands)
+}
+
+func (a *API) respondCommands(w http.ResponseWriter, commands []store.Command) {
+	now := time.Now()
+	resp := make([]commandResponse, 0, len(commands))
+	for _, cmd := range commands {
+		resp = append(resp, newCommandResponse(cmd, now))
+	}
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+// handleCommand lets the app follow a command through its lifecycle, for
+// example to confirm that "next track" actually happened.
+func (a *API) handleCommand(w http.ResponseWriter, r *http.Request, deviceID, rawCommandID string) {
+	if r.Method != http.MethodGet {
+		a.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	commandID, err := parseCommandID(rawCommandID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	cmd, err := a.store.GetCommand(r.Context(), deviceID, commandID)
+	if err != nil {
+		a.commandError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, newCommandResponse(cmd, time.Now()))
+}
+
+// handleCommandAck lets the device confirm it received a command, so it is
+// not delivered again, and report whether executing it succeeded. Without a
+// body it acknowledges delivery.
+func (a *API) handleCommandAck(w http.ResponseWriter, r *http.Request, deviceID, rawCommandID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	commandID, err := parseCommandID(rawCommandID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req commandAckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	status, err := store.ParseCommandAckStatus(strings.TrimSpace(req.Status))
+	if err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	req.Error = strings.TrimSpace(req.Error)
+	if req.Error != "" && status != store.CommandFailed {
+		a.badRequest(w, "error is only valid for failed commands")
+		return
+	}
+	if len(req.Error) > maxCommandError {
+		a.badRequest(w, fmt.Sprintf("error must be at most %d characters", maxCommandError))
+		return
+	}
+
+	cmd, err := a.store.AcknowledgeCommand(r.Context(), deviceID, commandID, store.CommandAck{
+		Status: status,
+		Error:  req.Error,
+	})
+	if err != nil {
+		a.commandError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, newCommandResponse(cmd, time.Now()))
+}
+
+func (a *API) commandError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrCommandNotFound):
+		http.Error(w, "command not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrCommandFinished):
+		a.respondJSON(w, http.StatusConflict, map[string]string{"error": "command already finished with a different status"})
+	default:
+		a.trackError(w, err)
+	}
+}
+
+func parseCommandID(raw string) (int64, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, errors.New("command id must be positive")
+	}
+	return id, nil
+}
+
+// isLongPoll reports whether r is a device waiting for commands. Long polls
+// mostly sit idle, so they do not take a concurrency slot.
+func isLongPoll(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/commands") && r.URL.Query().Has("wait")
+}
+
+func newCommandResponse(cmd store.Command, now time.Time) commandResponse {
+	return commandResponse{
+		ID:             cmd.ID,
+		Type:           string(cmd.Type),
+		Volume:         cmd.Volume,
+		PlaylistID:     cmd.PlaylistID,
+		Status:         string(cmd.StatusAt(now)),
+		Error:          cmd.Error,
+		CreatedAt:      cmd.CreatedAt,
+		ExpiresAt:      cmd.ExpiresAt,
+		AcknowledgedAt: cmd.AcknowledgedAt,
+		CompletedAt:    cmd.CompletedAt,
+	}
+}
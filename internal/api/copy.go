@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"sciplayer-api/internal/store"
+)
+
+// handlePlaylistCopy clones every playlist of sourceID onto deviceID. The
+// onDuplicate query parameter selects whether playlists whose name already
+// exists on the target are skipped (default) or overwritten.
+func (a *API) handlePlaylistCopy(w http.ResponseWriter, r *http.Request, deviceID, sourceID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if sourceID == deviceID {
+		a.badRequest(w, "source and target device must differ")
+		return
+	}
+
+	mode := store.CopySkip
+	switch onDuplicate := r.URL.Query().Get("onDuplicate"); onDuplicate {
+	case "", string(store.CopySkip):
+	case string(store.CopyOverwrite):
+		mode = store.CopyOverwrite
+	default:
+		a.badRequest(w, "onDuplicate must be skip or overwrite")
+		return
+	}
+
+	result, err := a.store.CopyPlaylists(r.Context(), sourceID, deviceID, mode)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrPlaylistQuota):
+			a.unprocessableEntity(w, err.Error())
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	playlists := make([]playlistResponse, 0, len(result.Playlists))
+	for _, pl := range result.Playlists {
+		playlists = append(playlists, newPlaylistResponse(pl))
+	}
+
+	a.respondJSON(w, http.StatusOK, map[string]any{
+		"deviceId":       deviceID,
+		"sourceDeviceId": sourceID,
+		"copied":         result.Copied,
+		"overwritten":    result.Overwritten,
+		"skipped":        result.Skipped,
+		"playlists":      playlists,
+	})
+}
@@ -0,0 +1,399 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const (
+	defaultDevicePageSize = 50
+	maxDevicePageSize     = 200
+
+	defaultDeviceStaleAfter   = 2 * time.Minute
+	defaultDeviceOfflineAfter = 10 * time.Minute
+)
+
+const (
+	deviceStatusOnline  = "online"
+	deviceStatusStale   = "stale"
+	deviceStatusOffline = "offline"
+)
+
+type deviceResponse struct {
+	DeviceID        string             `json:"deviceId"`
+	DisplayName     string             `json:"displayName"`
+	Model           string             `json:"model"`
+	FirmwareVersion string             `json:"firmwareVersion"`
+	CreatedAt       time.Time          `json:"createdAt"`
+	LastSeenAt      *time.Time         `json:"lastSeenAt"`
+	LastIP          string             `json:"lastIp"`
+	Status          string             `json:"status"`
+	Tags            []string           `json:"tags"`
+	PlaylistCount   int                `json:"playlistCount"`
+	PlaylistOrder   string             `json:"playlistOrder"`
+	LegalHold       *legalHoldResponse `json:"legalHold,omitempty"`
+	ArchivedAt      *time.Time         `json:"archivedAt,omitempty"`
+}
+
+type heartbeatRequest struct {
+	FirmwareVersion string `json:"firmwareVersion"`
+	IP              string `json:"ip"`
+}
+
+type devicePatchRequest struct {
+	DisplayName     *string   `json:"displayName"`
+	Model           *string   `json:"model"`
+	FirmwareVersion *string   `json:"firmwareVersion"`
+	Tags            *[]string `json:"tags"`
+	PlaylistOrder   *string   `json:"playlistOrder"`
+}
+
+type deviceListResponse struct {
+	Devices    []deviceResponse `json:"devices"`
+	NextCursor *string          `json:"nextCursor"`
+}
+
+func (a *API) handleDevice(w http.ResponseWriter, r *http.Request, deviceID string) {
+	switch r.Method {
+	case http.MethodGet:
+		a.getDevice(w, r, deviceID)
+	case http.MethodPatch:
+		a.patchDevice(w, r, deviceID)
+	case http.MethodDelete:
+		a.deleteDevice(w, r, deviceID)
+	default:
+		a.methodNotAllowed(w, http.MethodGet, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+func (a *API) getDevice(w http.ResponseWriter, r *http.Request, deviceID string) {
+	device, err := a.store.GetDevice(r.Context(), deviceID)
+	if err != nil {
+		if errors.Is(err, store.ErrDeviceNotFound) {
+			http.Error(w, "device not found", http.StatusNotFound)
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, a.newDeviceResponse(device, time.Now()))
+}
+
+// patchDevice changes the metadata fields present in the body. An empty
+// string clears a field.
+func (a *API) patchDevice(w http.ResponseWriter, r *http.Request, deviceID string) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req devicePatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if req.DisplayName == nil && req.Model == nil && req.FirmwareVersion == nil && req.Tags == nil &&
+		req.PlaylistOrder == nil {
+		a.badRequest(w, "at least one of displayName, model, firmwareVersion, tags or playlistOrder is required")
+		return
+	}
+
+	for _, field := range []*string{req.DisplayName, req.Model, req.FirmwareVersion} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+
+	if req.Tags != nil {
+		for i, tag := range *req.Tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" {
+				a.badRequest(w, "tags must not be empty")
+				return
+			}
+			(*req.Tags)[i] = tag
+		}
+	}
+
+	var order *store.PlaylistOrder
+	if req.PlaylistOrder != nil {
+		parsed, err := store.ParsePlaylistOrder(strings.TrimSpace(*req.PlaylistOrder))
+		if err != nil {
+			a.badRequest(w, "playlistOrder must be manual, alphabetical or newest")
+			return
+		}
+		order = &parsed
+	}
+
+	device, err := a.store.UpdateDevice(r.Context(), deviceID, store.DeviceUpdate{
+		DisplayName:     req.DisplayName,
+		Model:           req.Model,
+		FirmwareVersion: req.FirmwareVersion,
+		Tags:            req.Tags,
+		PlaylistOrder:   order,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrDeviceNotFound) {
+			http.Error(w, "device not found", http.StatusNotFound)
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, a.newDeviceResponse(device, time.Now()))
+}
+
+// handleHeartbeat records that a device is alive. The body is optional; when
+// it does not report an address the connection's remote address is used.
+func (a *API) handleHeartbeat(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req heartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	req.FirmwareVersion = strings.TrimSpace(req.FirmwareVersion)
+	req.IP = strings.TrimSpace(req.IP)
+
+	if req.IP != "" {
+		if net.ParseIP(req.IP) == nil {
+			a.badRequest(w, "ip must be a valid IP address")
+			return
+		}
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req.IP = host
+	}
+
+	err := a.store.RecordHeartbeat(r.Context(), deviceID, store.Heartbeat{
+		FirmwareVersion: req.FirmwareVersion,
+		IP:              req.IP,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrDeviceNotFound) {
+			http.Error(w, "device not found", http.StatusNotFound)
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeviceUnarchive returns an archived device to the fleet listing
+// without waiting for it to send a heartbeat.
+func (a *API) handleDeviceUnarchive(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	device, err := a.store.UnarchiveDevice(r.Context(), deviceID)
+	if err != nil {
+		if errors.Is(err, store.ErrDeviceNotFound) {
+			http.Error(w, "device not found", http.StatusNotFound)
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, a.newDeviceResponse(device, time.Now()))
+}
+
+// handleDeviceRename moves a device, with its playlists, to the identifier
+// in the body. Used when a reflashed player reports a new hardware ID.
+func (a *API) handleDeviceRename(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req deviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	if req.DeviceID == "" {
+		a.badRequest(w, "deviceId is required")
+		return
+	}
+	if req.DeviceID == deviceID {
+		a.badRequest(w, "deviceId must differ from the current identifier")
+		return
+	}
+
+	device, err := a.store.RenameDevice(r.Context(), deviceID, req.DeviceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrDeviceExists):
+			a.respondJSON(w, http.StatusConflict, map[string]string{"error": "device already exists"})
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, a.newDeviceResponse(device, time.Now()))
+}
+
+// deleteDevice removes a device together with its playlists. ?purge=true also
+// drops history kept for the device after deletion.
+func (a *API) deleteDevice(w http.ResponseWriter, r *http.Request, deviceID string) {
+	purge := r.URL.Query().Get("purge") == "true"
+
+	if err := a.store.DeleteDevice(r.Context(), deviceID, purge); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrLegalHold):
+			a.respondJSON(w, http.StatusConflict, map[string]string{"error": "device or one of its playlists is under legal hold"})
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) listDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultDevicePageSize
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxDevicePageSize {
+			a.badRequest(w, fmt.Sprintf("limit must be between 1 and %d", maxDevicePageSize))
+			return
+		}
+		limit = parsed
+	}
+
+	filter := store.DeviceFilter{
+		Limit:  limit,
+		Cursor: query.Get("cursor"),
+		Tag:    strings.TrimSpace(query.Get("tag")),
+	}
+
+	if raw := query.Get("archived"); raw != "" {
+		archived, err := strconv.ParseBool(raw)
+		if err != nil {
+			a.badRequest(w, "archived must be true or false")
+			return
+		}
+		filter.Archived = archived
+	}
+
+	now := time.Now()
+	staleSince := now.Add(-a.cfg.DeviceStaleAfter)
+	offlineSince := now.Add(-a.cfg.DeviceOfflineAfter)
+
+	switch status := query.Get("status"); status {
+	case "":
+	case deviceStatusOnline:
+		filter.SeenSince = staleSince
+	case deviceStatusStale:
+		filter.SeenSince = offlineSince
+		filter.NotSeenSince = staleSince
+	case deviceStatusOffline:
+		filter.NotSeenSince = offlineSince
+	default:
+		a.badRequest(w, "status must be one of online, stale or offline")
+		return
+	}
+
+	page, err := a.store.ListDevices(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			a.badRequest(w, "invalid cursor")
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	resp := deviceListResponse{
+		Devices: make([]deviceResponse, 0, len(page.Devices)),
+	}
+	for _, d := range page.Devices {
+		resp.Devices = append(resp.Devices, a.newDeviceResponse(d, now))
+	}
+	if page.NextCursor != "" {
+		resp.NextCursor = &page.NextCursor
+	}
+
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) newDeviceResponse(d store.Device, now time.Time) deviceResponse {
+	return deviceResponse{
+		DeviceID:        d.ID,
+		DisplayName:     d.DisplayName,
+		Model:           d.Model,
+		FirmwareVersion: d.FirmwareVersion,
+		CreatedAt:       d.CreatedAt,
+		LastSeenAt:      d.LastSeenAt,
+		LastIP:          d.LastIP,
+		Status:          a.deviceStatus(d.LastSeenAt, now),
+		Tags:            d.Tags,
+		PlaylistCount:   d.PlaylistCount,
+		PlaylistOrder:   string(d.PlaylistOrder),
+		LegalHold:       newLegalHoldResponse(d.LegalHold),
+		ArchivedAt:      d.ArchivedAt,
+	}
+}
+
+// deviceStatus classifies a device by the age of its last heartbeat. Devices
+// that never sent one are offline.
+func (a *API) deviceStatus(lastSeenAt *time.Time, now time.Time) string {
+	if lastSeenAt == nil {
+		return deviceStatusOffline
+	}
+
+	switch age := now.Sub(*lastSeenAt); {
+	case age < a.cfg.DeviceStaleAfter:
+		return deviceStatusOnline
+	case age < a.cfg.DeviceOfflineAfter:
+		return deviceStatusStale
+	default:
+		return deviceStatusOffline
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"sciplayer-api/internal/playlistfile"
+	"sciplayer-api/internal/store"
+)
+
+const (
+	expandFetchTimeout = 15 * time.Second
+	maxExpandBodyBytes = 1 << 20
+	maxExpandEntries   = 5000
+)
+
+var expandClient = newRestrictedClient(expandFetchTimeout)
+
+type expandResponse struct {
+	Tracks  []trackResponse `json:"tracks"`
+	Skipped int             `json:"skipped"`
+}
+
+// handlePlaylistExpand fetches the playlist's URL as an M3U/M3U8/PLS file and
+// replaces the playlist's tracks with its entries, for devices that cannot
+// parse those formats themselves.
+func (a *API) handlePlaylistExpand(w http.ResponseWriter, r *http.Request, deviceID, rawPlaylistID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	playlistID, err := parsePlaylistID(rawPlaylistID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	playlist, err := a.store.GetPlaylist(r.Context(), deviceID, playlistID)
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	source, err := url.Parse(playlist.URL)
+	if err != nil || (source.Scheme != "http" && source.Scheme != "https") {
+		a.unprocessableEntity(w, "playlist url must be http or https to expand")
+		return
+	}
+
+	// The server's write timeout is shorter than a slow upstream fetch.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(expandFetchTimeout + 5*time.Second)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		a.internalServerError(w, err)
+		return
+	}
+
+	content, contentType, err := fetchPlaylistFile(r, source)
+	if err != nil {
+		a.logger.Printf("expanding playlist %d for %s: %v", playlistID, deviceID, err)
+		if errors.Is(err, errRestrictedAddress) {
+			a.unprocessableEntity(w, "playlist url points to an address that cannot be fetched")
+			return
+		}
+		a.respondJSON(w, http.StatusBadGateway, map[string]string{"error": "could not fetch playlist url"})
+		return
+	}
+
+	format := playlistfile.DetectFormat(contentType, source.String(), content)
+	entries, err := playlistfile.Parse(bytes.NewReader(content), format, source)
+	if err != nil {
+		if errors.Is(err, playlistfile.ErrNoEntries) {
+			a.unprocessableEntity(w, "playlist file has no entries")
+			return
+		}
+		a.unprocessableEntity(w, "playlist file could not be parsed")
+		return
+	}
+
+	if len(entries) > maxExpandEntries {
+		a.unprocessableEntity(w, fmt.Sprintf("playlist file has more than %d entries", maxExpandEntries))
+		return
+	}
+
+	tracks := make([]store.NewTrack, 0, len(entries))
+	skipped := 0
+	for _, entry := range entries {
+		if validateURL(entry.URL) != nil {
+			skipped++
+			continue
+		}
+		tracks = append(tracks, store.NewTrack{
+			URL: entry.URL,
+			TrackMetadata: store.TrackMetadata{
+				Title:           entry.Title,
+				DurationSeconds: entry.DurationSeconds,
+			},
+		})
+	}
+
+	if len(tracks) == 0 {
+		a.unprocessableEntity(w, "playlist file has no usable entries")
+		return
+	}
+
+	stored, err := a.store.ReplaceTracks(r.Context(), deviceID, playlistID, tracks)
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	resp := expandResponse{Tracks: make([]trackResponse, 0, len(stored)), Skipped: skipped}
+	for _, t := range stored {
+		resp.Tracks = append(resp.Tracks, newTrackResponse(t))
+	}
+
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+// fetchPlaylistFile downloads at most maxExpandBodyBytes of the playlist file
+// and rejects anything larger rather than parsing a truncated list.
+func fetchPlaylistFile(r *http.Request, source *url.URL) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, source.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("building request: %w", err)
+	}
+
+	resp, err := expandClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetching playlist file: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxExpandBodyBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading playlist file: %w", err)
+	}
+	if len(content) > maxExpandBodyBytes {
+		return nil, "", fmt.Errorf("playlist file exceeds %d bytes", maxExpandBodyBytes)
+	}
+
+	return content, resp.Header.Get("Content-Type"), nil
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// faultSettings describes the faults applied to incoming requests. Each
+// percentage is evaluated independently per request.
+type faultSettings struct {
+	LatencyPercent int `json:"latencyPercent"`
+	LatencyMs      int `json:"latencyMs"`
+	ErrorPercent   int `json:"errorPercent"`
+	DropPercent    int `json:"dropPercent"`
+}
+
+type faultInjector struct {
+	mu       sync.RWMutex
+	settings faultSettings
+}
+
+func (f *faultInjector) get() faultSettings {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.settings
+}
+
+func (f *faultInjector) set(settings faultSettings) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.settings = settings
+}
+
+// apply injects the configured faults into the request. It reports whether
+// the request has been fully handled and must not reach the router.
+func (f *faultInjector) apply(w http.ResponseWriter, r *http.Request) bool {
+	settings := f.get()
+
+	if roll(settings.LatencyPercent) && settings.LatencyMs > 0 {
+		latency := time.Duration(settings.LatencyMs) * time.Millisecond
+
+		// Injected latency may exceed the server's write timeout; the
+		// request must still get its response afterwards.
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Now().Add(latency + 5*time.Second)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return false
+		}
+
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+
+	if roll(settings.DropPercent) {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				_ = conn.Close()
+				return true
+			}
+		}
+	}
+
+	if roll(settings.ErrorPercent) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "injected fault"})
+		return true
+	}
+
+	return false
+}
+
+func roll(percent int) bool {
+	return percent > 0 && rand.Intn(100) < percent
+}
+
+func (a *API) handleFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.respondJSON(w, http.StatusOK, a.faults.get())
+	case http.MethodPut:
+		a.updateFaults(w, r)
+	default:
+		a.methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (a *API) updateFaults(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req faultSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if err := validateFaultSettings(req); err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	a.faults.set(req)
+	a.logger.Printf("fault injection updated: %+v", req)
+
+	a.respondJSON(w, http.StatusOK, req)
+}
+
+func validateFaultSettings(settings faultSettings) error {
+	for _, percent := range []int{settings.LatencyPercent, settings.ErrorPercent, settings.DropPercent} {
+		if percent < 0 || percent > 100 {
+			return errors.New("percentages must be between 0 and 100")
+		}
+	}
+	if settings.LatencyMs < 0 || settings.LatencyMs > 60000 {
+		return errors.New("latencyMs must be between 0 and 60000")
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+type groupRequest struct {
+	Name string `json:"name"`
+}
+
+type groupMemberRequest struct {
+	DeviceID string `json:"deviceId"`
+}
+
+type groupResponse struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"createdAt"`
+	DeviceCount int       `json:"deviceCount"`
+}
+
+func (a *API) handleGroups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		a.createGroup(w, r)
+	case http.MethodGet:
+		a.listGroups(w, r)
+	default:
+		a.methodNotAllowed(w, http.MethodPost, http.MethodGet)
+	}
+}
+
+func (a *API) handleGroupSubroutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/groups/")
+	segments := strings.Split(path, "/")
+
+	groupID, err := parseGroupID(segments[0])
+	if err != nil {
+		a.badRequest(w, "invalid group id")
+		return
+	}
+
+	switch {
+	case len(segments) == 1:
+		a.handleGroup(w, r, groupID)
+	case len(segments) == 2 && segments[1] == "devices":
+		a.handleGroupDevices(w, r, groupID)
+	case len(segments) == 3 && segments[1] == "devices" && segments[2] != "":
+		if r.Method != http.MethodDelete {
+			a.methodNotAllowed(w, http.MethodDelete)
+			return
+		}
+		a.removeGroupDevice(w, r, groupID, segments[2])
+	case len(segments) == 2 && segments[1] == "playlists":
+		a.handleGroupPlaylists(w, r, groupID)
+	case len(segments) == 3 && segments[1] == "playlists":
+		if r.Method != http.MethodDelete {
+			a.methodNotAllowed(w, http.MethodDelete)
+			return
+		}
+		a.deleteGroupPlaylist(w, r, groupID, segments[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *API) createGroup(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req groupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		a.badRequest(w, "name is required")
+		return
+	}
+
+	group, err := a.store.CreateGroup(r.Context(), req.Name)
+	if err != nil {
+		if errors.Is(err, store.ErrGroupExists) {
+			a.respondJSON(w, http.StatusConflict, map[string]string{"error": "group already exists"})
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusCreated, newGroupResponse(group))
+}
+
+func (a *API) listGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := a.store.ListGroups(r.Context())
+	if err != nil {
+		a.internalServerError(w, err)
+		return
+	}
+
+	resp := make([]groupResponse, 0, len(groups))
+	for _, g := range groups {
+		resp = append(resp, newGroupResponse(g))
+	}
+
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleGroup(w http.ResponseWriter, r *http.Request, groupID int64) {
+	switch r.Method {
+	case http.MethodGet:
+		group, err := a.store.GetGroup(r.Context(), groupID)
+		if err != nil {
+			a.groupError(w, err)
+			return
+		}
+		a.respondJSON(w, http.StatusOK, newGroupResponse(group))
+	case http.MethodDelete:
+		if err := a.store.DeleteGroup(r.Context(), groupID); err != nil {
+			a.groupError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		a.methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+func (a *API) handleGroupDevices(w http.ResponseWriter, r *http.Request, groupID int64) {
+	switch r.Method {
+	case http.MethodPost:
+		a.addGroupDevice(w, r, groupID)
+	case http.MethodGet:
+		deviceIDs, err := a.store.ListGroupDevices(r.Context(), groupID)
+		if err != nil {
+			a.groupError(w, err)
+			return
+		}
+		a.respondJSON(w, http.StatusOK, map[string]any{"deviceIds": deviceIDs})
+	default:
+		a.methodNotAllowed(w, http.MethodPost, http.MethodGet)
+	}
+}
+
+func (a *API) addGroupDevice(w http.ResponseWriter, r *http.Request, groupID int64) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req groupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	if req.DeviceID == "" {
+		a.badRequest(w, "deviceId is required")
+		return
+	}
+
+	if err := a.store.AddGroupDevice(r.Context(), groupID, req.DeviceID); err != nil {
+		a.groupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) removeGroupDevice(w http.ResponseWriter, r *http.Request, groupID int64, deviceID string) {
+	if err := a.store.RemoveGroupDevice(r.Context(), groupID, deviceID); err != nil {
+		a.groupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) handleGroupPlaylists(w http.ResponseWriter, r *http.Request, groupID int64) {
+	switch r.Method {
+	case http.MethodPost:
+		a.addGroupPlaylist(w, r, groupID)
+	case http.MethodGet:
+		playlists, err := a.store.ListGroupPlaylists(r.Context(), groupID)
+		if err != nil {
+			a.groupError(w, err)
+			return
+		}
+
+		resp := make([]playlistResponse, 0, len(playlists))
+		for _, pl := range playlists {
+			resp = append(resp, newPlaylistResponse(pl))
+		}
+		a.respondJSON(w, http.StatusOK, resp)
+	default:
+		a.methodNotAllowed(w, http.MethodPost, http.MethodGet)
+	}
+}
+
+func (a *API) addGroupPlaylist(w http.ResponseWriter, r *http.Request, groupID int64) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req playlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if err := normalizePlaylistRequest(&req); err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	playlist, err := a.store.AddGroupPlaylist(r.Context(), groupID, store.NewPlaylist{
+		Name:       req.Name,
+		URL:        req.URL,
+		ArtworkURL: req.ArtworkURL,
+	})
+	if err != nil {
+		a.groupError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusCreated, newPlaylistResponse(playlist))
+}
+
+func (a *API) deleteGroupPlaylist(w http.ResponseWriter, r *http.Request, groupID int64, rawPlaylistID string) {
+	playlistID, err := parsePlaylistID(rawPlaylistID)
+	if err != nil {
+		a.badRequest(w, "invalid playlist id")
+		return
+	}
+
+	if err := a.store.DeleteGroupPlaylist(r.Context(), groupID, playlistID); err != nil {
+		a.groupError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// groupError maps store errors from group operations to responses.
+func (a *API) groupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrGroupNotFound):
+		http.Error(w, "group not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrDeviceNotFound):
+		http.Error(w, "device not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrPlaylistNotFound):
+		http.Error(w, "playlist not found", http.StatusNotFound)
+	default:
+		a.internalServerError(w, err)
+	}
+}
+
+func parseGroupID(raw string) (int64, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, errors.New("group id must be positive")
+	}
+	return id, nil
+}
+
+func newGroupResponse(g store.Group) groupResponse {
+	return groupResponse{
+		ID:          g.ID,
+		Name:        g.Name,
+		CreatedAt:   g.CreatedAt,
+		DeviceCount: g.DeviceCount,
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"sciplayer-api/internal/importers"
+	"sciplayer-api/internal/store"
+)
+
+const maxImportBytes = 32 << 20
+
+type importResponse struct {
+	DevicesCreated   int `json:"devicesCreated"`
+	DevicesExisting  int `json:"devicesExisting"`
+	PlaylistsCreated int `json:"playlistsCreated"`
+	PlaylistsSkipped int `json:"playlistsSkipped"`
+	TracksCreated    int `json:"tracksCreated"`
+}
+
+// handleAdminImport migrates devices and playlists from another system's
+// export, given as the request body in the format named by ?format=. The
+// whole export is validated before anything is stored, and stored in one
+// transaction.
+func (a *API) handleAdminImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	format, err := importers.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	devices, err := importers.Parse(format, http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			a.respondJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("export must be at most %d bytes", maxImportBytes)})
+			return
+		}
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	if err := normalizeImport(devices); err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	summary, err := a.store.ImportDevices(r.Context(), devices)
+	if err != nil {
+		if errors.Is(err, store.ErrPlaylistQuota) {
+			a.unprocessableEntity(w, err.Error())
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	a.logger.Printf("imported %d devices (%d new), %d playlists and %d tracks from %s export",
+		len(devices), summary.DevicesCreated, summary.PlaylistsCreated, summary.TracksCreated, format)
+
+	a.respondJSON(w, http.StatusOK, importResponse{
+		DevicesCreated:   summary.DevicesCreated,
+		DevicesExisting:  summary.DevicesExisting,
+		PlaylistsCreated: summary.PlaylistsCreated,
+		PlaylistsSkipped: summary.PlaylistsSkipped,
+		TracksCreated:    summary.TracksCreated,
+	})
+}
+
+// normalizeImport applies the same rules as the device, playlist and track
+// endpoints to every imported item, and reports the first failure with its
+// location in the export.
+func normalizeImport(devices []store.ImportedDevice) error {
+	seen := make(map[string]int, len(devices))
+
+	for i := range devices {
+		device := &devices[i]
+
+		device.ID = strings.TrimSpace(device.ID)
+		if device.ID == "" {
+			return fmt.Errorf("devices[%d]: deviceId is required", i)
+		}
+		if first, ok := seen[device.ID]; ok {
+			return fmt.Errorf("devices[%d]: deviceId %q repeats devices[%d]", i, device.ID, first)
+		}
+		seen[device.ID] = i
+
+		device.DisplayName = strings.TrimSpace(device.DisplayName)
+		device.Model = strings.TrimSpace(device.Model)
+		device.FirmwareVersion = strings.TrimSpace(device.FirmwareVersion)
+
+		for j := range device.Playlists {
+			playlist := &device.Playlists[j]
+
+			req := playlistRequest{Name: playlist.Name, URL: playlist.URL, ArtworkURL: playlist.ArtworkURL}
+			if err := normalizePlaylistRequest(&req); err != nil {
+				return fmt.Errorf("devices[%d].playlists[%d]: %w", i, j, err)
+			}
+			playlist.NewPlaylist = store.NewPlaylist{Name: req.Name, URL: req.URL, ArtworkURL: req.ArtworkURL}
+
+			for k := range playlist.Tracks {
+				track := &playlist.Tracks[k]
+
+				req := trackRequest{
+					URL:             track.URL,
+					Title:           track.Title,
+					Artist:          track.Artist,
+					Album:           track.Album,
+					DurationSeconds: track.DurationSeconds,
+					MimeType:        track.MimeType,
+					ContentHash:     track.ContentHash,
+					ArtworkURL:      track.ArtworkURL,
+				}
+				if err := normalizeTrackRequest(&req); err != nil {
+					return fmt.Errorf("devices[%d].playlists[%d].tracks[%d]: %w", i, j, k, err)
+				}
+
+				track.URL = req.URL
+				track.ContentHash = req.ContentHash
+				track.TrackMetadata = store.TrackMetadata{
+					Title:           req.Title,
+					Artist:          req.Artist,
+					Album:           req.Album,
+					DurationSeconds: req.DurationSeconds,
+					MimeType:        req.MimeType,
+					ArtworkURL:      req.ArtworkURL,
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const maxLegalHoldReasonLength = 500
+
+type legalHoldRequest struct {
+	Reason string `json:"reason"`
+}
+
+type legalHoldResponse struct {
+	Reason   string    `json:"reason"`
+	PlacedAt time.Time `json:"placedAt"`
+}
+
+// handleDeviceLegalHold places (PUT) or releases (DELETE) a hold that blocks
+// deleting the device, including ?purge=true erasure.
+func (a *API) handleDeviceLegalHold(w http.ResponseWriter, r *http.Request, deviceID string) {
+	a.handleLegalHold(w, r, func(hold *store.LegalHold) error {
+		return a.store.SetDeviceLegalHold(r.Context(), deviceID, hold)
+	})
+}
+
+// handlePlaylistLegalHold places or releases a hold that blocks moving the
+// playlist to the trash and purging it.
+func (a *API) handlePlaylistLegalHold(w http.ResponseWriter, r *http.Request, deviceID, rawPlaylistID string) {
+	playlistID, err := parsePlaylistID(rawPlaylistID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	a.handleLegalHold(w, r, func(hold *store.LegalHold) error {
+		return a.store.SetPlaylistLegalHold(r.Context(), deviceID, playlistID, hold)
+	})
+}
+
+func (a *API) handleLegalHold(w http.ResponseWriter, r *http.Request, apply func(*store.LegalHold) error) {
+	var hold *store.LegalHold
+
+	switch r.Method {
+	case http.MethodPut:
+		defer func(Body io.ReadCloser) {
+			err := Body.Close()
+			if err != nil {
+
+			}
+		}(r.Body)
+
+		var req legalHoldRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			a.badRequest(w, "invalid JSON payload")
+			return
+		}
+
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			a.badRequest(w, "reason is required")
+			return
+		}
+		if len(req.Reason) > maxLegalHoldReasonLength {
+			a.badRequest(w, fmt.Sprintf("reason must be at most %d characters", maxLegalHoldReasonLength))
+			return
+		}
+
+		hold = &store.LegalHold{Reason: req.Reason, PlacedAt: time.Now().UTC().Truncate(time.Second)}
+	case http.MethodDelete:
+	default:
+		a.methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		return
+	}
+
+	if err := apply(hold); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrPlaylistNotFound):
+			http.Error(w, "playlist not found", http.StatusNotFound)
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	if hold == nil {
+		a.logger.Printf("legal hold released: %s", r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	a.logger.Printf("legal hold placed: %s reason=%q", r.URL.Path, hold.Reason)
+	a.respondJSON(w, http.StatusOK, newLegalHoldResponse(hold))
+}
+
+func newLegalHoldResponse(hold *store.LegalHold) *legalHoldResponse {
+	if hold == nil {
+		return nil
+	}
+	return &legalHoldResponse{Reason: hold.Reason, PlacedAt: hold.PlacedAt}
+}
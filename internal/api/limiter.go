@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// routeClass groups requests that share an in-flight budget. Writes are kept
+// separate because SQLite serialises them behind a single connection.
+type routeClass string
+
+const (
+	routeClassRead  routeClass = "read"
+	routeClassWrite routeClass = "write"
+)
+
+// concurrencyLimiter sheds requests once a class has too many in flight,
+// answering 503 with Retry-After instead of queueing behind the database.
+type concurrencyLimiter struct {
+	slots      map[routeClass]chan struct{}
+	retryAfter int
+}
+
+func newConcurrencyLimiter(maxReads, maxWrites, retryAfterSeconds int) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		slots:      make(map[routeClass]chan struct{}),
+		retryAfter: retryAfterSeconds,
+	}
+	if maxReads > 0 {
+		l.slots[routeClassRead] = make(chan struct{}, maxReads)
+	}
+	if maxWrites > 0 {
+		l.slots[routeClassWrite] = make(chan struct{}, maxWrites)
+	}
+	return l
+}
+
+func classify(r *http.Request) routeClass {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return routeClassRead
+	default:
+		return routeClassWrite
+	}
+}
+
+// acquire reserves a slot for the request. It returns a release function, or
+// false when the class is saturated.
+func (l *concurrencyLimiter) acquire(r *http.Request) (func(), bool) {
+	slots, ok := l.slots[classify(r)]
+	if !ok {
+		return func() {}, true
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	default:
+		return nil, false
+	}
+}
+
+func (a *API) serviceUnavailable(w http.ResponseWriter, retryAfter int) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	a.respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "server is busy, retry later"})
+}
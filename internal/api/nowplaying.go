@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+type nowPlayingRequest struct {
+	PlaylistID      *int64 `json:"playlistId"`
+	TrackID         *int64 `json:"trackId"`
+	PositionSeconds int    `json:"positionSeconds"`
+}
+
+type nowPlayingResponse struct {
+	PlaylistID      *int64    `json:"playlistId"`
+	TrackID         *int64    `json:"trackId"`
+	PositionSeconds int       `json:"positionSeconds"`
+	Playing         bool      `json:"playing"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// handleNowPlaying lets a device report what it is playing and companion apps
+// read it back. The state is replaced on every PUT; a report without a
+// playlist means the device is stopped.
+func (a *API) handleNowPlaying(w http.ResponseWriter, r *http.Request, deviceID string) {
+	switch r.Method {
+	case http.MethodPut:
+		a.putNowPlaying(w, r, deviceID)
+	case http.MethodGet:
+		np, err := a.store.GetNowPlaying(r.Context(), deviceID)
+		if err != nil {
+			a.nowPlayingError(w, err)
+			return
+		}
+		a.respondJSON(w, http.StatusOK, newNowPlayingResponse(np))
+	default:
+		a.methodNotAllowed(w, http.MethodPut, http.MethodGet)
+	}
+}
+
+func (a *API) putNowPlaying(w http.ResponseWriter, r *http.Request, deviceID string) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req nowPlayingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	switch {
+	case req.PlaylistID != nil && *req.PlaylistID <= 0:
+		a.badRequest(w, "playlistId must be positive")
+		return
+	case req.TrackID != nil && *req.TrackID <= 0:
+		a.badRequest(w, "trackId must be positive")
+		return
+	case req.TrackID != nil && req.PlaylistID == nil:
+		a.badRequest(w, "trackId requires playlistId")
+		return
+	case req.PositionSeconds < 0:
+		a.badRequest(w, "positionSeconds must not be negative")
+		return
+	}
+
+	np, err := a.store.SetNowPlaying(r.Context(), deviceID, store.NowPlaying{
+		PlaylistID:      req.PlaylistID,
+		TrackID:         req.TrackID,
+		PositionSeconds: req.PositionSeconds,
+	})
+	if err != nil {
+		a.nowPlayingError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, newNowPlayingResponse(np))
+}
+
+func (a *API) nowPlayingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrDeviceNotFound):
+		http.Error(w, "device not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrNowPlayingUnset):
+		http.Error(w, "now playing not reported", http.StatusNotFound)
+	default:
+		a.internalServerError(w, err)
+	}
+}
+
+func newNowPlayingResponse(np store.NowPlaying) nowPlayingResponse {
+	return nowPlayingResponse{
+		PlaylistID:      np.PlaylistID,
+		TrackID:         np.TrackID,
+		PositionSeconds: np.PositionSeconds,
+		Playing:         np.PlaylistID != nil,
+		UpdatedAt:       np.UpdatedAt,
+	}
+}
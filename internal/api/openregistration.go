@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// registrationVerifyTimeout stays well under the server's 5s write timeout,
+// so a slow verifier still gets its 502 back to the device.
+const registrationVerifyTimeout = 3 * time.Second
+
+var registrationVerifyClient = &http.Client{Timeout: registrationVerifyTimeout}
+
+// registrationLimiter counts open registrations per client address in fixed
+// windows. Entries from past windows are dropped as new requests arrive, so
+// memory stays bounded by the addresses seen within one window.
+type registrationLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string]registrationWindow
+}
+
+type registrationWindow struct {
+	start time.Time
+	count int
+}
+
+func newRegistrationLimiter(limit int, window time.Duration) *registrationLimiter {
+	return &registrationLimiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string]registrationWindow),
+	}
+}
+
+// allow records an attempt from addr. When the address is over its limit it
+// returns false and how long until its window resets.
+func (l *registrationLimiter) allow(addr string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, w := range l.hits {
+		if now.Sub(w.start) >= l.window {
+			delete(l.hits, key)
+		}
+	}
+
+	w, ok := l.hits[addr]
+	if !ok {
+		w = registrationWindow{start: now}
+	}
+	if w.count >= l.limit {
+		return w.start.Add(l.window).Sub(now), false
+	}
+
+	w.count++
+	l.hits[addr] = w
+	return 0, true
+}
+
+// guardOpenRegistration applies the rate limit and verification hook to a
+// registration without a token. It writes the rejection and returns false
+// when the request must not proceed.
+func (a *API) guardOpenRegistration(w http.ResponseWriter, r *http.Request, verificationToken string) bool {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		addr = host
+	}
+
+	if a.registrations != nil {
+		if wait, ok := a.registrations.allow(addr, time.Now()); !ok {
+			seconds := int((wait + time.Second - 1) / time.Second)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			a.respondJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many registrations, retry later"})
+			a.logger.Printf("open registration from %s rate limited", addr)
+			return false
+		}
+	}
+
+	if a.cfg.RegistrationVerifyURL == "" {
+		return true
+	}
+
+	if verificationToken == "" {
+		a.respondJSON(w, http.StatusForbidden, map[string]string{"error": "verificationToken is required"})
+		return false
+	}
+
+	verified, err := a.verifyRegistration(r.Context(), verificationToken, addr)
+	if err != nil {
+		a.logger.Printf("registration verification failed: %v", err)
+		a.respondJSON(w, http.StatusBadGateway, map[string]string{"error": "could not verify registration"})
+		return false
+	}
+	if !verified {
+		a.respondJSON(w, http.StatusForbidden, map[string]string{"error": "verification failed"})
+		return false
+	}
+
+	return true
+}
+
+// verifyRegistration checks a CAPTCHA or proof-of-work response with the
+// configured endpoint. It speaks the siteverify protocol shared by reCAPTCHA,
+// hCaptcha and Turnstile: a form POST of secret, response and remoteip,
+// answered with {"success": true|false}.
+func (a *API) verifyRegistration(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{
+		"secret":   {a.cfg.RegistrationVerifySecret},
+		"response": {token},
+		"remoteip": {remoteIP},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.RegistrationVerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("building verification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := registrationVerifyClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("calling verification endpoint: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("verification endpoint returned %s", resp.Status)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("decoding verification response: %w", err)
+	}
+
+	return result.Success, nil
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// errRestrictedAddress is returned when a user-supplied URL resolves to an
+// address the server must not reach on a caller's behalf.
+var errRestrictedAddress = errors.New("address not allowed")
+
+// newRestrictedClient returns a client for fetching URLs that API callers
+// control. It refuses to connect to loopback, private, link-local and
+// unspecified addresses. The check runs on the resolved address of every
+// connection, so it also covers redirects and DNS names that resolve to an
+// internal address. Proxies from the environment are not used, since the
+// check would only see the proxy's address.
+func newRestrictedClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: refuseRestrictedAddress,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func refuseRestrictedAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errRestrictedAddress, address)
+	}
+
+	addr := addrPort.Addr().Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", errRestrictedAddress, addr)
+	}
+
+	return nil
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+type playbackRequest struct {
+	TrackID         int64 `json:"trackId"`
+	PositionSeconds *int  `json:"positionSeconds"`
+}
+
+type playbackResponse struct {
+	TrackID         int64     `json:"trackId"`
+	PlaylistID      int64     `json:"playlistId"`
+	PositionSeconds int       `json:"positionSeconds"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// handlePlayback lets a device save resume points for its tracks and read
+// them back after a restart.
+func (a *API) handlePlayback(w http.ResponseWriter, r *http.Request, deviceID string) {
+	switch r.Method {
+	case http.MethodPut:
+		a.savePlayback(w, r, deviceID)
+	case http.MethodGet:
+		positions, err := a.store.ListPlaybackPositions(r.Context(), deviceID)
+		if err != nil {
+			a.trackError(w, err)
+			return
+		}
+
+		resp := make([]playbackResponse, 0, len(positions))
+		for _, pos := range positions {
+			resp = append(resp, newPlaybackResponse(pos))
+		}
+		a.respondJSON(w, http.StatusOK, resp)
+	default:
+		a.methodNotAllowed(w, http.MethodPut, http.MethodGet)
+	}
+}
+
+func (a *API) savePlayback(w http.ResponseWriter, r *http.Request, deviceID string) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req playbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if req.TrackID <= 0 {
+		a.badRequest(w, "trackId is required")
+		return
+	}
+
+	if req.PositionSeconds == nil {
+		a.badRequest(w, "positionSeconds is required")
+		return
+	}
+
+	if *req.PositionSeconds < 0 {
+		a.badRequest(w, "positionSeconds must not be negative")
+		return
+	}
+
+	pos, err := a.store.SavePlaybackPosition(r.Context(), deviceID, req.TrackID, *req.PositionSeconds)
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, newPlaybackResponse(pos))
+}
+
+const (
+	defaultPlaybackEventLimit = 50
+	maxPlaybackEventLimit     = 200
+)
+
+type playbackEventRequest struct {
+	TrackID   int64      `json:"trackId"`
+	StartedAt *time.Time `json:"startedAt"`
+}
+
+type playbackEventResponse struct {
+	ID              int64     `json:"id"`
+	TrackID         *int64    `json:"trackId"`
+	PlaylistID      *int64    `json:"playlistId"`
+	Title           string    `json:"title"`
+	Artist          string    `json:"artist"`
+	URL             string    `json:"url"`
+	DurationSeconds *int      `json:"durationSeconds"`
+	StartedAt       time.Time `json:"startedAt"`
+}
+
+// handlePlaybackEvents records tracks as the device starts them and serves
+// the history back for "recently played" views.
+func (a *API) handlePlaybackEvents(w http.ResponseWriter, r *http.Request, deviceID string) {
+	switch r.Method {
+	case http.MethodPost:
+		a.recordPlaybackEvent(w, r, deviceID)
+	case http.MethodGet:
+		a.listPlaybackEvents(w, r, deviceID)
+	default:
+		a.methodNotAllowed(w, http.MethodPost, http.MethodGet)
+	}
+}
+
+func (a *API) recordPlaybackEvent(w http.ResponseWriter, r *http.Request, deviceID string) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req playbackEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if req.TrackID <= 0 {
+		a.badRequest(w, "trackId is required")
+		return
+	}
+
+	// Devices that were offline report their backlog with the original
+	// start times; everything else is recorded as starting now.
+	now := time.Now()
+	startedAt := now
+	if req.StartedAt != nil {
+		if req.StartedAt.After(now.Add(a.cfg.ClockDriftThreshold)) {
+			a.badRequest(w, "startedAt must not be in the future")
+			return
+		}
+		startedAt = *req.StartedAt
+	}
+
+	event, err := a.store.RecordPlaybackEvent(r.Context(), deviceID, req.TrackID, startedAt)
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusCreated, newPlaybackEventResponse(event))
+}
+
+func (a *API) listPlaybackEvents(w http.ResponseWriter, r *http.Request, deviceID string) {
+	query := r.URL.Query()
+
+	filter := store.PlaybackEventFilter{Limit: defaultPlaybackEventLimit}
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxPlaybackEventLimit {
+			a.badRequest(w, fmt.Sprintf("limit must be between 1 and %d", maxPlaybackEventLimit))
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	since, until, err := parseTimeRange(query)
+	if err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+	filter.Since, filter.Until = since, until
+
+	events, err := a.store.ListPlaybackEvents(r.Context(), deviceID, filter)
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	resp := make([]playbackEventResponse, 0, len(events))
+	for _, event := range events {
+		resp = append(resp, newPlaybackEventResponse(event))
+	}
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+type playbackStatsResponse struct {
+	TotalPlays          int                         `json:"totalPlays"`
+	TotalListenSeconds  int                         `json:"totalListenSeconds"`
+	TotalSessions       int                         `json:"totalSessions"`
+	TotalSessionSeconds int                         `json:"totalSessionSeconds"`
+	Playlists           []playlistPlayStatsResponse `json:"playlists"`
+}
+
+type playlistPlayStatsResponse struct {
+	PlaylistID     *int64 `json:"playlistId"`
+	Name           string `json:"name"`
+	Plays          int    `json:"plays"`
+	ListenSeconds  int    `json:"listenSeconds"`
+	Sessions       int    `json:"sessions"`
+	SessionSeconds int    `json:"sessionSeconds"`
+}
+
+// handlePlaybackStats aggregates the device's playback history and sessions
+// per playlist over an optional since/until range.
+func (a *API) handlePlaybackStats(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodGet {
+		a.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	since, until, err := parseTimeRange(r.URL.Query())
+	if err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	stats, err := a.store.GetPlaybackStats(r.Context(), deviceID, since, until)
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	resp := playbackStatsResponse{
+		TotalPlays:          stats.TotalPlays,
+		TotalListenSeconds:  stats.TotalListenSeconds,
+		TotalSessions:       stats.TotalSessions,
+		TotalSessionSeconds: stats.TotalSessionSeconds,
+		Playlists:           make([]playlistPlayStatsResponse, 0, len(stats.Playlists)),
+	}
+	for _, entry := range stats.Playlists {
+		resp.Playlists = append(resp.Playlists, playlistPlayStatsResponse{
+			PlaylistID:     entry.PlaylistID,
+			Name:           entry.Name,
+			Plays:          entry.Plays,
+			ListenSeconds:  entry.ListenSeconds,
+			Sessions:       entry.Sessions,
+			SessionSeconds: entry.SessionSeconds,
+		})
+	}
+
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+// parseTimeRange reads the optional since and until RFC3339 parameters and
+// reports the first problem as a client-facing message.
+func parseTimeRange(query url.Values) (since, until time.Time, err error) {
+	if raw := query.Get("since"); raw != "" {
+		if since, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			return time.Time{}, time.Time{}, errors.New("since must be an RFC3339 timestamp")
+		}
+	}
+
+	if raw := query.Get("until"); raw != "" {
+		if until, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			return time.Time{}, time.Time{}, errors.New("until must be an RFC3339 timestamp")
+		}
+	}
+
+	if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		return time.Time{}, time.Time{}, errors.New("since must be before until")
+	}
+
+	return since, until, nil
+}
+
+func newPlaybackEventResponse(event store.PlaybackEvent) playbackEventResponse {
+	return playbackEventResponse{
+		ID:              event.ID,
+		TrackID:         event.TrackID,
+		PlaylistID:      event.PlaylistID,
+		Title:           event.Title,
+		Artist:          event.Artist,
+		URL:             event.URL,
+		DurationSeconds: event.DurationSeconds,
+		StartedAt:       event.StartedAt,
+	}
+}
+
+func newPlaybackResponse(pos store.PlaybackPosition) playbackResponse {
+	return playbackResponse{
+		TrackID:         pos.TrackID,
+		PlaylistID:      pos.PlaylistID,
+		PositionSeconds: pos.PositionSeconds,
+		UpdatedAt:       pos.UpdatedAt,
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const (
+	defaultRegistrationTokenTTL = 24 * time.Hour
+	maxRegistrationTokenTTL     = 30 * 24 * time.Hour
+)
+
+type registrationTokenRequest struct {
+	TTLSeconds int `json:"ttlSeconds"`
+}
+
+type registrationTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// handleRegistrationTokens issues a one-time token a device can present to
+// POST /devices. Only a hash is stored, so the token is shown once. Issuing
+// tokens takes the admin credential, since a token bypasses every check on
+// open registration.
+func (a *API) handleRegistrationTokens(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeAdmin(w, r) {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req registrationTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	ttl := defaultRegistrationTokenTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+		if ttl <= 0 || ttl > maxRegistrationTokenTTL {
+			a.badRequest(w, fmt.Sprintf("ttlSeconds must be between 1 and %d", int(maxRegistrationTokenTTL.Seconds())))
+			return
+		}
+	}
+
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		a.internalServerError(w, fmt.Errorf("generating registration token: %w", err))
+		return
+	}
+	token := hex.EncodeToString(b[:])
+
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	if err := a.store.CreateRegistrationToken(r.Context(), hashRegistrationToken(token), expiresAt); err != nil {
+		a.internalServerError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusCreated, registrationTokenResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// registerDevice creates a device by spending a registration token. Unlike
+// plain registration it is not idempotent: the token is gone after one use.
+func (a *API) registerDevice(w http.ResponseWriter, r *http.Request, deviceID, token string, meta store.DeviceMetadata) {
+	err := a.store.RegisterDevice(r.Context(), hashRegistrationToken(token), deviceID, meta)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidRegistrationToken):
+			a.respondJSON(w, http.StatusForbidden, map[string]string{"error": "invalid or expired registration token"})
+		case errors.Is(err, store.ErrDeviceExists):
+			a.respondJSON(w, http.StatusConflict, map[string]string{"error": "device already exists"})
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	a.respondJSON(w, http.StatusCreated, map[string]any{
+		"deviceId": deviceID,
+		"created":  true,
+	})
+}
+
+func hashRegistrationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
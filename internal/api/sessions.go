@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+type playbackSessionRequest struct {
+	PlaylistID int64 `json:"playlistId"`
+}
+
+type playbackSessionResponse struct {
+	ID           int64      `json:"id"`
+	PlaylistID   *int64     `json:"playlistId"`
+	PlaylistName string     `json:"playlistName"`
+	StartedAt    time.Time  `json:"startedAt"`
+	EndedAt      *time.Time `json:"endedAt"`
+	EndReason    string     `json:"endReason,omitempty"`
+}
+
+// handlePlaybackSessions lets a device open a session when it starts playing
+// a playlist and serves the session history back.
+func (a *API) handlePlaybackSessions(w http.ResponseWriter, r *http.Request, deviceID string) {
+	switch r.Method {
+	case http.MethodPost:
+		a.openPlaybackSession(w, r, deviceID)
+	case http.MethodGet:
+		a.listPlaybackSessions(w, r, deviceID)
+	default:
+		a.methodNotAllowed(w, http.MethodPost, http.MethodGet)
+	}
+}
+
+func (a *API) openPlaybackSession(w http.ResponseWriter, r *http.Request, deviceID string) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req playbackSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if req.PlaylistID <= 0 {
+		a.badRequest(w, "playlistId is required")
+		return
+	}
+
+	session, err := a.store.OpenPlaybackSession(r.Context(), deviceID, req.PlaylistID)
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusCreated, newPlaybackSessionResponse(session))
+}
+
+func (a *API) listPlaybackSessions(w http.ResponseWriter, r *http.Request, deviceID string) {
+	query := r.URL.Query()
+
+	filter := store.PlaybackEventFilter{Limit: defaultPlaybackEventLimit}
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxPlaybackEventLimit {
+			a.badRequest(w, fmt.Sprintf("limit must be between 1 and %d", maxPlaybackEventLimit))
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	since, until, err := parseTimeRange(query)
+	if err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+	filter.Since, filter.Until = since, until
+
+	sessions, err := a.store.ListPlaybackSessions(r.Context(), deviceID, filter)
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	resp := make([]playbackSessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, newPlaybackSessionResponse(session))
+	}
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+// handlePlaybackSessionClose ends a session when the device stops playing.
+func (a *API) handlePlaybackSessionClose(w http.ResponseWriter, r *http.Request, deviceID, rawSessionID string) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	sessionID, err := strconv.ParseInt(rawSessionID, 10, 64)
+	if err != nil || sessionID <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	session, err := a.store.ClosePlaybackSession(r.Context(), deviceID, sessionID)
+	if err != nil {
+		if errors.Is(err, store.ErrSessionNotFound) {
+			http.Error(w, "playback session not found", http.StatusNotFound)
+			return
+		}
+		a.trackError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, newPlaybackSessionResponse(session))
+}
+
+func newPlaybackSessionResponse(session store.PlaybackSession) playbackSessionResponse {
+	return playbackSessionResponse{
+		ID:           session.ID,
+		PlaylistID:   session.PlaylistID,
+		PlaylistName: session.PlaylistName,
+		StartedAt:    session.StartedAt,
+		EndedAt:      session.EndedAt,
+		EndReason:    string(session.EndReason),
+	}
+}
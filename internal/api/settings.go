@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const (
+	maxCrossfadeSeconds = 30
+	maxEQPresetLength   = 64
+)
+
+// deviceSettings is the settings document. Every field is optional; a
+// device restores what is present and keeps its defaults for the rest.
+type deviceSettings struct {
+	Volume            *int   `json:"volume,omitempty"`
+	Muted             *bool  `json:"muted,omitempty"`
+	Balance           *int   `json:"balance,omitempty"`
+	EQPreset          string `json:"eqPreset,omitempty"`
+	CrossfadeSeconds  *int   `json:"crossfadeSeconds,omitempty"`
+	NormalizeLoudness *bool  `json:"normalizeLoudness,omitempty"`
+}
+
+type deviceSettingsResponse struct {
+	deviceSettings
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// handleDeviceSettings stores a device's audio configuration so it can be
+// restored after the device is reflashed. PUT replaces the whole document.
+func (a *API) handleDeviceSettings(w http.ResponseWriter, r *http.Request, deviceID string) {
+	switch r.Method {
+	case http.MethodPut:
+		a.putDeviceSettings(w, r, deviceID)
+	case http.MethodGet:
+		settings, err := a.store.GetDeviceSettings(r.Context(), deviceID)
+		if err != nil {
+			a.settingsError(w, err)
+			return
+		}
+		resp, err := newDeviceSettingsResponse(settings)
+		if err != nil {
+			a.internalServerError(w, err)
+			return
+		}
+		a.respondJSON(w, http.StatusOK, resp)
+	default:
+		a.methodNotAllowed(w, http.MethodPut, http.MethodGet)
+	}
+}
+
+func (a *API) putDeviceSettings(w http.ResponseWriter, r *http.Request, deviceID string) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req deviceSettings
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			a.badRequest(w, "unknown setting "+field)
+			return
+		}
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	req.EQPreset = strings.TrimSpace(req.EQPreset)
+
+	switch {
+	case req.Volume != nil && (*req.Volume < 0 || *req.Volume > 100):
+		a.badRequest(w, "volume must be between 0 and 100")
+		return
+	case req.Balance != nil && (*req.Balance < -100 || *req.Balance > 100):
+		a.badRequest(w, "balance must be between -100 and 100")
+		return
+	case len(req.EQPreset) > maxEQPresetLength:
+		a.badRequest(w, fmt.Sprintf("eqPreset must be at most %d characters", maxEQPresetLength))
+		return
+	case req.CrossfadeSeconds != nil && (*req.CrossfadeSeconds < 0 || *req.CrossfadeSeconds > maxCrossfadeSeconds):
+		a.badRequest(w, fmt.Sprintf("crossfadeSeconds must be between 0 and %d", maxCrossfadeSeconds))
+		return
+	}
+
+	document, err := json.Marshal(req)
+	if err != nil {
+		a.internalServerError(w, err)
+		return
+	}
+
+	settings, err := a.store.SaveDeviceSettings(r.Context(), deviceID, document)
+	if err != nil {
+		a.settingsError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, deviceSettingsResponse{deviceSettings: req, UpdatedAt: settings.UpdatedAt})
+}
+
+func (a *API) settingsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrDeviceNotFound):
+		http.Error(w, "device not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrSettingsUnset):
+		http.Error(w, "device settings not stored", http.StatusNotFound)
+	default:
+		a.internalServerError(w, err)
+	}
+}
+
+func newDeviceSettingsResponse(settings store.DeviceSettings) (deviceSettingsResponse, error) {
+	resp := deviceSettingsResponse{UpdatedAt: settings.UpdatedAt}
+	if err := json.Unmarshal(settings.Document, &resp.deviceSettings); err != nil {
+		return deviceSettingsResponse{}, fmt.Errorf("decoding device settings: %w", err)
+	}
+	return resp, nil
+}
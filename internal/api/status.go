@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statusPage holds the process start time and the incident banner shown on
+// the public status endpoint. The banner lives in memory and is cleared on
+// restart.
+type statusPage struct {
+	startedAt time.Time
+
+	mu     sync.RWMutex
+	banner *statusBanner
+}
+
+type statusBanner struct {
+	Message   string    `json:"message"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type statusBannerRequest struct {
+	Message string `json:"message"`
+}
+
+type statusResponse struct {
+	Status        string        `json:"status"`
+	Database      string        `json:"database"`
+	StartedAt     time.Time     `json:"startedAt"`
+	UptimeSeconds int64         `json:"uptimeSeconds"`
+	Banner        *statusBanner `json:"banner"`
+}
+
+func (p *statusPage) getBanner() *statusBanner {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.banner
+}
+
+func (p *statusPage) setBanner(banner *statusBanner) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.banner = banner
+}
+
+func (a *API) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	resp := statusResponse{
+		Status:        "ok",
+		Database:      "ok",
+		StartedAt:     a.status.startedAt.UTC(),
+		UptimeSeconds: int64(time.Since(a.status.startedAt).Seconds()),
+		Banner:        a.status.getBanner(),
+	}
+
+	if err := a.store.Ping(ctx); err != nil {
+		a.logger.Printf("status check: database unavailable: %v", err)
+		resp.Status = "degraded"
+		resp.Database = "unavailable"
+	}
+
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handleStatusBanner(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		a.setStatusBanner(w, r)
+	case http.MethodDelete:
+		a.status.setBanner(nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		a.methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (a *API) setStatusBanner(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req statusBannerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		a.badRequest(w, "message is required")
+		return
+	}
+
+	banner := &statusBanner{
+		Message:   req.Message,
+		UpdatedAt: time.Now().UTC(),
+	}
+	a.status.setBanner(banner)
+
+	a.respondJSON(w, http.StatusOK, banner)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+)
+
+type storageResponse struct {
+	DatabaseBytes int64            `json:"databaseBytes"`
+	FreeBytes     int64            `json:"freeBytes"`
+	TableRows     map[string]int64 `json:"tableRows"`
+	WarningBytes  int64            `json:"warningBytes,omitempty"`
+	Warning       bool             `json:"warning"`
+}
+
+func (a *API) handleStorage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	stats, err := a.store.StorageStats(r.Context())
+	if err != nil {
+		a.internalServerError(w, err)
+		return
+	}
+
+	resp := storageResponse{
+		DatabaseBytes: stats.DatabaseBytes,
+		FreeBytes:     stats.FreeBytes,
+		TableRows:     stats.TableRows,
+		WarningBytes:  a.cfg.StorageWarningBytes,
+		Warning:       a.cfg.StorageWarningBytes > 0 && stats.DatabaseBytes >= a.cfg.StorageWarningBytes,
+	}
+
+	if resp.Warning {
+		a.logger.Printf("storage warning: database is %d bytes (threshold %d)", stats.DatabaseBytes, a.cfg.StorageWarningBytes)
+	}
+
+	a.respondJSON(w, http.StatusOK, resp)
+}
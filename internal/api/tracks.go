@@ -0,0 +1,471 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+// maxContentHashLength fits a hex-encoded SHA-512 digest with an algorithm
+// prefix.
+const maxContentHashLength = 160
+
+type trackRequest struct {
+	Title           string `json:"title"`
+	URL             string `json:"url"`
+	Artist          string `json:"artist"`
+	Album           string `json:"album"`
+	DurationSeconds *int   `json:"durationSeconds"`
+	MimeType        string `json:"mimeType"`
+	ContentHash     string `json:"contentHash"`
+	ArtworkURL      string `json:"artworkUrl"`
+}
+
+type trackPatchRequest struct {
+	URL             *string `json:"url"`
+	Title           *string `json:"title"`
+	Artist          *string `json:"artist"`
+	Album           *string `json:"album"`
+	DurationSeconds *int    `json:"durationSeconds"`
+	MimeType        *string `json:"mimeType"`
+	ArtworkURL      *string `json:"artworkUrl"`
+}
+
+type trackReorderRequest struct {
+	TrackIDs []int64 `json:"trackIds"`
+}
+
+type trackFeedbackRequest struct {
+	Event string `json:"event"`
+}
+
+type trackFeedbackResponse struct {
+	Likes    int `json:"likes"`
+	Dislikes int `json:"dislikes"`
+	Skips    int `json:"skips"`
+}
+
+type trackResponse struct {
+	ID              int64     `json:"id"`
+	PlaylistID      int64     `json:"playlistId"`
+	Title           string    `json:"title"`
+	Artist          string    `json:"artist"`
+	Album           string    `json:"album"`
+	DurationSeconds *int      `json:"durationSeconds"`
+	MimeType        string    `json:"mimeType"`
+	URL             string    `json:"url"`
+	ContentHash     string    `json:"contentHash,omitempty"`
+	ArtworkURL      string    `json:"artworkUrl,omitempty"`
+	ArtworkProxyURL string    `json:"artworkProxyUrl,omitempty"`
+	Position        int       `json:"position"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+func (a *API) handleTracks(w http.ResponseWriter, r *http.Request, deviceID, rawPlaylistID string) {
+	playlistID, err := parsePlaylistID(rawPlaylistID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		a.addTrack(w, r, deviceID, playlistID)
+	case http.MethodGet:
+		a.listTracks(w, r, deviceID, playlistID)
+	default:
+		a.methodNotAllowed(w, http.MethodPost, http.MethodGet)
+	}
+}
+
+func (a *API) handleTrack(w http.ResponseWriter, r *http.Request, deviceID, rawPlaylistID, rawTrackID string) {
+	playlistID, err := parsePlaylistID(rawPlaylistID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	trackID, err := parseTrackID(rawTrackID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		a.patchTrack(w, r, deviceID, playlistID, trackID)
+	case http.MethodDelete:
+		a.deleteTrack(w, r, deviceID, playlistID, trackID)
+	default:
+		a.methodNotAllowed(w, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+func (a *API) handleTrackReorder(w http.ResponseWriter, r *http.Request, deviceID, rawPlaylistID string) {
+	playlistID, err := parsePlaylistID(rawPlaylistID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req trackReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if err := a.store.ReorderTracks(r.Context(), deviceID, playlistID, req.TrackIDs); err != nil {
+		if errors.Is(err, store.ErrInvalidTrackOrder) {
+			a.badRequest(w, "trackIds must list every track of the playlist exactly once")
+			return
+		}
+		a.trackError(w, err)
+		return
+	}
+
+	a.listTracks(w, r, deviceID, playlistID)
+}
+
+func (a *API) addTrack(w http.ResponseWriter, r *http.Request, deviceID string, playlistID int64) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req trackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if err := normalizeTrackRequest(&req); err != nil {
+		a.badRequest(w, err.Error())
+		return
+	}
+
+	track, created, err := a.store.AddTrack(r.Context(), deviceID, playlistID, store.NewTrack{
+		URL:         req.URL,
+		ContentHash: req.ContentHash,
+		TrackMetadata: store.TrackMetadata{
+			Title:           req.Title,
+			Artist:          req.Artist,
+			Album:           req.Album,
+			DurationSeconds: req.DurationSeconds,
+			MimeType:        req.MimeType,
+			ArtworkURL:      req.ArtworkURL,
+		},
+	})
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+
+	a.respondJSON(w, status, newTrackResponse(track))
+}
+
+// listTracks returns the tracks in position order, or with ?order=shuffle
+// in a shuffled order that is the same for every request with the same seed,
+// so several devices can play one playlist in step.
+func (a *API) listTracks(w http.ResponseWriter, r *http.Request, deviceID string, playlistID int64) {
+	query := r.URL.Query()
+
+	var shuffleSeed string
+	switch query.Get("order") {
+	case "", "position":
+	case "shuffle":
+		shuffleSeed = query.Get("seed")
+		if shuffleSeed == "" {
+			a.badRequest(w, "seed is required when order is shuffle")
+			return
+		}
+	default:
+		a.badRequest(w, "order must be position or shuffle")
+		return
+	}
+
+	tracks, err := a.store.ListTracks(r.Context(), deviceID, playlistID)
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	if shuffleSeed != "" {
+		shuffleTracks(tracks, shuffleSeed)
+	}
+
+	resp := make([]trackResponse, 0, len(tracks))
+	for _, t := range tracks {
+		resp = append(resp, newTrackResponse(t))
+	}
+
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+// patchTrack changes only the fields present in the body. Text metadata can
+// be cleared with an empty string; url cannot.
+func (a *API) patchTrack(w http.ResponseWriter, r *http.Request, deviceID string, playlistID, trackID int64) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req trackPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	if req.URL == nil && req.Title == nil && req.Artist == nil && req.Album == nil &&
+		req.DurationSeconds == nil && req.MimeType == nil && req.ArtworkURL == nil {
+		a.badRequest(w, "at least one track field is required")
+		return
+	}
+
+	for _, field := range []*string{req.URL, req.Title, req.Artist, req.Album, req.MimeType, req.ArtworkURL} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+
+	if req.URL != nil {
+		if err := validateURL(*req.URL); err != nil {
+			a.badRequest(w, "url must be a valid absolute URL")
+			return
+		}
+	}
+
+	if req.DurationSeconds != nil && *req.DurationSeconds < 0 {
+		a.badRequest(w, "durationSeconds must not be negative")
+		return
+	}
+
+	if req.MimeType != nil && *req.MimeType != "" {
+		if _, _, err := mime.ParseMediaType(*req.MimeType); err != nil {
+			a.badRequest(w, "mimeType must be a valid media type")
+			return
+		}
+	}
+
+	if req.ArtworkURL != nil {
+		if err := validateArtworkURL(*req.ArtworkURL); err != nil {
+			a.badRequest(w, err.Error())
+			return
+		}
+	}
+
+	track, err := a.store.UpdateTrack(r.Context(), deviceID, playlistID, trackID, store.TrackUpdate{
+		URL:             req.URL,
+		Title:           req.Title,
+		Artist:          req.Artist,
+		Album:           req.Album,
+		DurationSeconds: req.DurationSeconds,
+		MimeType:        req.MimeType,
+		ArtworkURL:      req.ArtworkURL,
+	})
+	if err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, newTrackResponse(track))
+}
+
+func (a *API) deleteTrack(w http.ResponseWriter, r *http.Request, deviceID string, playlistID, trackID int64) {
+	if err := a.store.DeleteTrack(r.Context(), deviceID, playlistID, trackID); err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTrackFeedback records like/dislike/skip events from the device and
+// returns the running totals for the track.
+func (a *API) handleTrackFeedback(w http.ResponseWriter, r *http.Request, deviceID, rawPlaylistID, rawTrackID string) {
+	playlistID, err := parsePlaylistID(rawPlaylistID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	trackID, err := parseTrackID(rawTrackID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		a.addTrackFeedback(w, r, deviceID, playlistID, trackID)
+	case http.MethodGet:
+		fb, err := a.store.GetTrackFeedback(r.Context(), deviceID, playlistID, trackID)
+		if err != nil {
+			a.trackError(w, err)
+			return
+		}
+		a.respondJSON(w, http.StatusOK, trackFeedbackResponse{
+			Likes:    fb.Likes,
+			Dislikes: fb.Dislikes,
+			Skips:    fb.Skips,
+		})
+	default:
+		a.methodNotAllowed(w, http.MethodPost, http.MethodGet)
+	}
+}
+
+func (a *API) addTrackFeedback(w http.ResponseWriter, r *http.Request, deviceID string, playlistID, trackID int64) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(r.Body)
+
+	var req trackFeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.badRequest(w, "invalid JSON payload")
+		return
+	}
+
+	event := store.FeedbackEvent(strings.ToLower(strings.TrimSpace(req.Event)))
+	switch event {
+	case store.FeedbackLike, store.FeedbackDislike, store.FeedbackSkip:
+	default:
+		a.badRequest(w, "event must be like, dislike or skip")
+		return
+	}
+
+	if err := a.store.RecordTrackFeedback(r.Context(), deviceID, playlistID, trackID, event); err != nil {
+		a.trackError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// shuffleTracks is a Fisher-Yates shuffle driven by a PCG generator seeded
+// from the seed string. It avoids rand.Shuffle so the order does not depend
+// on the Go release the server was built with.
+func shuffleTracks(tracks []store.Track, seed string) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(seed))
+	sum := h.Sum64()
+	rng := rand.NewPCG(sum, sum^0x9e3779b97f4a7c15)
+
+	for i := len(tracks) - 1; i > 0; i-- {
+		j := int(rng.Uint64() % uint64(i+1))
+		tracks[i], tracks[j] = tracks[j], tracks[i]
+	}
+}
+
+// trackError maps store errors from track operations to responses.
+func (a *API) trackError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrDeviceNotFound):
+		http.Error(w, "device not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrPlaylistNotFound):
+		http.Error(w, "playlist not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrTrackNotFound):
+		http.Error(w, "track not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrLegalHold):
+		a.respondJSON(w, http.StatusConflict, map[string]string{"error": "playlist or its device is under legal hold"})
+	default:
+		a.internalServerError(w, err)
+	}
+}
+
+// normalizeTrackRequest trims the request fields and reports the first
+// validation failure as a client-facing message.
+func normalizeTrackRequest(req *trackRequest) error {
+	req.URL = strings.TrimSpace(req.URL)
+	req.Title = strings.TrimSpace(req.Title)
+	req.Artist = strings.TrimSpace(req.Artist)
+	req.Album = strings.TrimSpace(req.Album)
+	req.MimeType = strings.TrimSpace(req.MimeType)
+	req.ContentHash = strings.TrimSpace(req.ContentHash)
+	req.ArtworkURL = strings.TrimSpace(req.ArtworkURL)
+
+	if req.URL == "" {
+		return errors.New("url is required")
+	}
+
+	if err := validateURL(req.URL); err != nil {
+		return errors.New("url must be a valid absolute URL")
+	}
+
+	if req.DurationSeconds != nil && *req.DurationSeconds < 0 {
+		return errors.New("durationSeconds must not be negative")
+	}
+
+	if req.MimeType != "" {
+		if _, _, err := mime.ParseMediaType(req.MimeType); err != nil {
+			return errors.New("mimeType must be a valid media type")
+		}
+	}
+
+	if len(req.ContentHash) > maxContentHashLength {
+		return fmt.Errorf("contentHash must be at most %d characters", maxContentHashLength)
+	}
+
+	return validateArtworkURL(req.ArtworkURL)
+}
+
+func parseTrackID(raw string) (int64, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, errors.New("track id must be positive")
+	}
+	return id, nil
+}
+
+func newTrackResponse(t store.Track) trackResponse {
+	return trackResponse{
+		ID:              t.ID,
+		PlaylistID:      t.PlaylistID,
+		Title:           t.Title,
+		Artist:          t.Artist,
+		Album:           t.Album,
+		DurationSeconds: t.DurationSeconds,
+		MimeType:        t.MimeType,
+		URL:             t.URL,
+		ContentHash:     t.ContentHash,
+		ArtworkURL:      t.ArtworkURL,
+		ArtworkProxyURL: artworkProxyPath(t.ArtworkURL),
+		Position:        t.Position,
+		CreatedAt:       t.CreatedAt,
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"sciplayer-api/internal/store"
+)
+
+func (a *API) handlePlaylistTrash(w http.ResponseWriter, r *http.Request, deviceID string) {
+	if r.Method != http.MethodGet {
+		a.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	playlists, err := a.store.ListDeletedPlaylists(r.Context(), deviceID)
+	if err != nil {
+		if errors.Is(err, store.ErrDeviceNotFound) {
+			http.Error(w, "device not found", http.StatusNotFound)
+			return
+		}
+		a.internalServerError(w, err)
+		return
+	}
+
+	resp := make([]playlistResponse, 0, len(playlists))
+	for _, pl := range playlists {
+		resp = append(resp, newPlaylistResponse(pl))
+	}
+
+	a.respondJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) handlePlaylistRestore(w http.ResponseWriter, r *http.Request, deviceID, rawPlaylistID string) {
+	playlistID, err := parsePlaylistID(rawPlaylistID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	playlist, err := a.store.RestorePlaylist(r.Context(), deviceID, playlistID)
+	if err != nil {
+		var duplicate *store.DuplicatePlaylistError
+		switch {
+		case errors.Is(err, store.ErrDeviceNotFound):
+			http.Error(w, "device not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrPlaylistNotFound):
+			http.Error(w, "playlist not found in trash", http.StatusNotFound)
+		case errors.As(err, &duplicate):
+			a.duplicatePlaylist(w, duplicate)
+		case errors.Is(err, store.ErrPlaylistQuota):
+			a.unprocessableEntity(w, err.Error())
+		default:
+			a.internalServerError(w, err)
+		}
+		return
+	}
+
+	a.respondJSON(w, http.StatusOK, newPlaylistResponse(playlist))
+}
@@ -0,0 +1,75 @@
+// Package archive periodically archives devices that have stopped checking
+// in, so decommissioned hardware drops out of fleet listings.
+package archive
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+// Archiver sweeps the store on an interval. Devices inactive for longer than
+// after minus warning are logged once as due for archival; devices inactive
+// for longer than after, and warned at least warning ago, are archived.
+type Archiver struct {
+	store    store.Store
+	after    time.Duration
+	warning  time.Duration
+	interval time.Duration
+	logger   *log.Logger
+}
+
+func NewArchiver(s store.Store, after, warning, interval time.Duration, logger *log.Logger) *Archiver {
+	return &Archiver{
+		store:    s,
+		after:    after,
+		warning:  warning,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run sweeps immediately and then on every interval until ctx is cancelled.
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.SweepOnce(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			a.logger.Printf("device archival failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Archiver) SweepOnce(ctx context.Context, now time.Time) error {
+	var warnedBefore time.Time
+	if a.warning > 0 {
+		warnedBefore = now.Add(-a.warning)
+
+		warned, err := a.store.WarnInactiveDevices(ctx, now.Add(-(a.after - a.warning)))
+		if err != nil {
+			return err
+		}
+		for _, deviceID := range warned {
+			a.logger.Printf("device %s will be archived within %s unless it checks in", deviceID, a.warning)
+		}
+	}
+
+	archived, err := a.store.ArchiveInactiveDevices(ctx, now.Add(-a.after), warnedBefore)
+	if err != nil {
+		return err
+	}
+	for _, deviceID := range archived {
+		a.logger.Printf("device %s archived after %s without a heartbeat", deviceID, a.after)
+	}
+
+	return nil
+}
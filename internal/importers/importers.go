@@ -0,0 +1,55 @@
+// Package importers converts device and playlist exports from other player
+// and signage systems into sciplayer devices, so fleets can be migrated in
+// one request. Each format lives in its own file and is registered in
+// ParseFormat and Parse.
+package importers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"sciplayer-api/internal/store"
+)
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+)
+
+var ErrNoDevices = errors.New("export contains no devices")
+
+func ParseFormat(value string) (Format, error) {
+	switch f := Format(value); f {
+	case FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown import format %q (want json)", value)
+	}
+}
+
+// Parse reads an export in the given format. The result is not validated
+// beyond what the format itself requires.
+func Parse(format Format, r io.Reader) ([]store.ImportedDevice, error) {
+	var (
+		devices []store.ImportedDevice
+		err     error
+	)
+
+	switch format {
+	case FormatJSON:
+		devices, err = parseJSON(r)
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(devices) == 0 {
+		return nil, ErrNoDevices
+	}
+
+	return devices, nil
+}
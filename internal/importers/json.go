@@ -0,0 +1,82 @@
+package importers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"sciplayer-api/internal/store"
+)
+
+// jsonExport is the generic format, for systems without a dedicated
+// importer. Field names follow the sciplayer API, so a script converting
+// another system's export only has to reshape it.
+type jsonExport struct {
+	Devices []struct {
+		DeviceID        string `json:"deviceId"`
+		DisplayName     string `json:"displayName"`
+		Model           string `json:"model"`
+		FirmwareVersion string `json:"firmwareVersion"`
+		Playlists       []struct {
+			Name       string `json:"name"`
+			URL        string `json:"url"`
+			ArtworkURL string `json:"artworkUrl"`
+			Tracks     []struct {
+				URL             string `json:"url"`
+				Title           string `json:"title"`
+				Artist          string `json:"artist"`
+				Album           string `json:"album"`
+				DurationSeconds *int   `json:"durationSeconds"`
+				MimeType        string `json:"mimeType"`
+				ContentHash     string `json:"contentHash"`
+				ArtworkURL      string `json:"artworkUrl"`
+			} `json:"tracks"`
+		} `json:"playlists"`
+	} `json:"devices"`
+}
+
+func parseJSON(r io.Reader) ([]store.ImportedDevice, error) {
+	var export jsonExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("decoding json export: %w", err)
+	}
+
+	devices := make([]store.ImportedDevice, 0, len(export.Devices))
+	for _, d := range export.Devices {
+		device := store.ImportedDevice{
+			ID: d.DeviceID,
+			DeviceMetadata: store.DeviceMetadata{
+				DisplayName:     d.DisplayName,
+				Model:           d.Model,
+				FirmwareVersion: d.FirmwareVersion,
+			},
+		}
+
+		for _, p := range d.Playlists {
+			playlist := store.ImportedPlaylist{
+				NewPlaylist: store.NewPlaylist{Name: p.Name, URL: p.URL, ArtworkURL: p.ArtworkURL},
+			}
+
+			for _, t := range p.Tracks {
+				playlist.Tracks = append(playlist.Tracks, store.NewTrack{
+					URL:         t.URL,
+					ContentHash: t.ContentHash,
+					TrackMetadata: store.TrackMetadata{
+						Title:           t.Title,
+						Artist:          t.Artist,
+						Album:           t.Album,
+						DurationSeconds: t.DurationSeconds,
+						MimeType:        t.MimeType,
+						ArtworkURL:      t.ArtworkURL,
+					},
+				})
+			}
+
+			device.Playlists = append(device.Playlists, playlist)
+		}
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
@@ -0,0 +1,215 @@
+// Package playlistfile parses M3U, M3U8 and PLS playlist files into their
+// entries so the server can expand them into tracks for devices that cannot
+// parse these formats themselves.
+package playlistfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatM3U Format = "m3u"
+	FormatPLS Format = "pls"
+)
+
+var ErrNoEntries = errors.New("playlist file has no entries")
+
+// Entry is one item of a playlist file. DurationSeconds is nil when the file
+// does not state a length.
+type Entry struct {
+	URL             string
+	Title           string
+	DurationSeconds *int
+}
+
+// DetectFormat picks the format from the content type, then the URL
+// extension, then the content itself. M3U is the fallback since it is also
+// valid as a bare list of URLs.
+func DetectFormat(contentType, rawURL string, content []byte) Format {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mediaType {
+		case "audio/x-scpls":
+			return FormatPLS
+		case "audio/x-mpegurl", "audio/mpegurl", "application/x-mpegurl", "application/vnd.apple.mpegurl":
+			return FormatM3U
+		}
+	}
+
+	if parsed, err := url.Parse(rawURL); err == nil {
+		switch strings.ToLower(path.Ext(parsed.Path)) {
+		case ".pls":
+			return FormatPLS
+		case ".m3u", ".m3u8":
+			return FormatM3U
+		}
+	}
+
+	if bytes.HasPrefix(bytes.ToLower(bytes.TrimSpace(content)), []byte("[playlist]")) {
+		return FormatPLS
+	}
+
+	return FormatM3U
+}
+
+// Parse reads the entries of a playlist file. Relative entry URLs are
+// resolved against base.
+func Parse(r io.Reader, format Format, base *url.URL) ([]Entry, error) {
+	var (
+		entries []Entry
+		err     error
+	)
+
+	switch format {
+	case FormatPLS:
+		entries, err = parsePLS(r)
+	default:
+		entries, err = parseM3U(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := entries[:0]
+	for _, entry := range entries {
+		ref, err := url.Parse(entry.URL)
+		if err != nil {
+			continue
+		}
+		if base != nil {
+			ref = base.ResolveReference(ref)
+		}
+		entry.URL = ref.String()
+		resolved = append(resolved, entry)
+	}
+
+	if len(resolved) == 0 {
+		return nil, ErrNoEntries
+	}
+
+	return resolved, nil
+}
+
+// parseM3U handles both plain and extended M3U. #EXTINF lines provide the
+// duration and title of the entry that follows; other directives are ignored.
+func parseM3U(r io.Reader) ([]Entry, error) {
+	var (
+		entries []Entry
+		pending Entry
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+
+		if info, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+			rawDuration, title, _ := strings.Cut(info, ",")
+			// Attributes such as tvg-id="..." may follow the duration.
+			rawDuration, _, _ = strings.Cut(rawDuration, " ")
+			pending = Entry{Title: strings.TrimSpace(title), DurationSeconds: parseSeconds(rawDuration)}
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pending.URL = line
+		entries = append(entries, pending)
+		pending = Entry{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// parsePLS reads FileN, TitleN and LengthN keys. Entries are returned in N
+// order regardless of where they appear in the file.
+func parsePLS(r io.Reader) ([]Entry, error) {
+	byIndex := make(map[int]*Entry)
+	var order []int
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var field string
+		for _, prefix := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+
+		index, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if err != nil {
+			continue
+		}
+
+		entry, ok := byIndex[index]
+		if !ok {
+			entry = &Entry{}
+			byIndex[index] = entry
+			order = append(order, index)
+		}
+
+		switch field {
+		case "file":
+			entry.URL = value
+		case "title":
+			entry.Title = value
+		case "length":
+			entry.DurationSeconds = parseSeconds(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.Sort(order)
+
+	entries := make([]Entry, 0, len(order))
+	for _, index := range order {
+		if entry := byIndex[index]; entry.URL != "" {
+			entries = append(entries, *entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// parseSeconds returns nil for missing or negative lengths, which both
+// formats use for streams of unknown duration.
+func parseSeconds(raw string) *int {
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || seconds < 0 {
+		return nil
+	}
+	rounded := int(seconds + 0.5)
+	return &rounded
+}
@@ -0,0 +1,45 @@
+// Package reqid carries the per-request identifier from the HTTP layer to
+// the store so log lines and SQL statements can be tied back to an API call.
+package reqid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const maxLength = 64
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID, or an empty string outside a request.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+func New() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Valid reports whether a client-supplied ID is safe to echo into logs and
+// SQL comments: short and limited to letters, digits, '-', '_' and '.'.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
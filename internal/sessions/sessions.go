@@ -0,0 +1,62 @@
+// Package sessions periodically closes playback sessions left open by
+// devices that stopped checking in, typically because they crashed or lost
+// power mid-play.
+package sessions
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+// Closer sweeps the store on an interval and closes the open sessions of
+// devices without a heartbeat for longer than timeout. Closed sessions end
+// at the device's last heartbeat, so the sweep interval does not affect
+// session durations.
+type Closer struct {
+	store    store.Store
+	timeout  time.Duration
+	interval time.Duration
+	logger   *log.Logger
+}
+
+func NewCloser(s store.Store, timeout, interval time.Duration, logger *log.Logger) *Closer {
+	return &Closer{
+		store:    s,
+		timeout:  timeout,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run sweeps immediately and then on every interval until ctx is cancelled.
+func (c *Closer) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.SweepOnce(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			c.logger.Printf("closing stale playback sessions failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Closer) SweepOnce(ctx context.Context, now time.Time) error {
+	closed, err := c.store.CloseStaleSessions(ctx, now.Add(-c.timeout))
+	if err != nil {
+		return err
+	}
+	if closed > 0 {
+		c.logger.Printf("closed %d playback sessions after %s without a heartbeat", closed, c.timeout)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+// inactiveDevice matches devices whose last heartbeat, or registration when
+// they never sent one, is before the bound timestamp.
+const inactiveDevice = `archived_at IS NULL AND COALESCE(last_seen_at, created_at) < ?`
+
+// WarnInactiveDevices marks devices inactive since before the cutoff as
+// warned and returns them. Each device is returned once until it is seen
+// again.
+func (s *Store) WarnInactiveDevices(ctx context.Context, inactiveSince time.Time) ([]string, error) {
+	const query = `
+        UPDATE devices
+        SET archive_warned_at = CURRENT_TIMESTAMP
+        WHERE ` + inactiveDevice + ` AND archive_warned_at IS NULL
+        RETURNING device_identifier;
+    `
+
+	return queryDeviceIDs(ctx, s.db, query, formatTimestamp(inactiveSince))
+}
+
+// ArchiveInactiveDevices archives devices inactive since before the cutoff
+// and returns their identifiers. When warnedBefore is set, only devices
+// warned before it are archived, so every device gets the full notice
+// period. Archived devices keep all of their data.
+func (s *Store) ArchiveInactiveDevices(ctx context.Context, inactiveSince, warnedBefore time.Time) ([]string, error) {
+	query := `
+        UPDATE devices
+        SET archived_at = CURRENT_TIMESTAMP
+        WHERE ` + inactiveDevice
+	args := []any{formatTimestamp(inactiveSince)}
+
+	if !warnedBefore.IsZero() {
+		query += ` AND archive_warned_at <= ?`
+		args = append(args, formatTimestamp(warnedBefore))
+	}
+
+	query += `
+        RETURNING device_identifier;`
+
+	return queryDeviceIDs(ctx, s.db, query, args...)
+}
+
+// UnarchiveDevice returns an archived device to the active list. The
+// inactivity clock restarts so the next sweep does not archive it again.
+func (s *Store) UnarchiveDevice(ctx context.Context, deviceID string) (store.Device, error) {
+	const query = `
+        UPDATE devices
+        SET archived_at = NULL,
+            archive_warned_at = NULL,
+            last_seen_at = CASE WHEN archived_at IS NULL THEN last_seen_at ELSE CURRENT_TIMESTAMP END
+        WHERE device_identifier = ?;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, deviceID)
+	if err != nil {
+		return store.Device{}, fmt.Errorf("unarchiving device: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return store.Device{}, fmt.Errorf("checking unarchive result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.Device{}, store.ErrDeviceNotFound
+	}
+
+	return getDevice(ctx, s.db, deviceID)
+}
+
+func queryDeviceIDs(ctx context.Context, q querier, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("updating inactive devices: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	deviceIDs := make([]string, 0)
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, fmt.Errorf("scanning device id: %w", err)
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating device ids: %w", err)
+	}
+
+	return deviceIDs, nil
+}
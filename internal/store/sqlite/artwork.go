@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+// FindArtworkURL resolves an artwork ID to the URL of a playlist or track
+// that uses it. Only referenced URLs can be resolved, so the proxy cannot be
+// pointed at arbitrary hosts. The scan runs only on a cache miss.
+func (s *Store) FindArtworkURL(ctx context.Context, artworkID string) (string, error) {
+	const query = `
+        SELECT artwork_url FROM playlists WHERE artwork_url != ''
+        UNION
+        SELECT artwork_url FROM tracks WHERE artwork_url != ''
+        UNION
+        SELECT artwork_url FROM catalog_entries WHERE artwork_url != '';
+    `
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("fetching artwork urls: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	for rows.Next() {
+		var artworkURL string
+		if err := rows.Scan(&artworkURL); err != nil {
+			return "", fmt.Errorf("scanning artwork url: %w", err)
+		}
+		if store.ArtworkID(artworkURL) == artworkID {
+			return artworkURL, nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("iterating artwork urls: %w", err)
+	}
+
+	return "", store.ErrArtworkNotFound
+}
+
+func (s *Store) GetArtwork(ctx context.Context, artworkID string) (store.Artwork, error) {
+	const query = `
+        SELECT id, url, content_type, data, fetched_at
+        FROM artwork_cache
+        WHERE id = ?;
+    `
+
+	var a store.Artwork
+	err := s.db.QueryRowContext(ctx, query, artworkID).Scan(&a.ID, &a.URL, &a.ContentType, &a.Data, &a.FetchedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Artwork{}, store.ErrArtworkNotFound
+		}
+		return store.Artwork{}, fmt.Errorf("fetching artwork: %w", err)
+	}
+
+	return a, nil
+}
+
+// SaveArtwork stores or refreshes a cached artwork image.
+func (s *Store) SaveArtwork(ctx context.Context, artwork store.Artwork) error {
+	const query = `
+        INSERT INTO artwork_cache (id, url, content_type, data, fetched_at)
+        VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT(id) DO UPDATE SET
+            url = excluded.url,
+            content_type = excluded.content_type,
+            data = excluded.data,
+            fetched_at = excluded.fetched_at;
+    `
+
+	_, err := s.db.ExecContext(ctx, query,
+		artwork.ID, artwork.URL, artwork.ContentType, artwork.Data, formatTimestamp(artwork.FetchedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("saving artwork: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+const catalogColumns = `id, name, url, artwork_url, description, created_at`
+
+func (s *Store) AddCatalogEntry(ctx context.Context, playlist store.NewPlaylist, description string) (store.CatalogEntry, error) {
+	const query = `
+        INSERT INTO catalog_entries (name, url, artwork_url, description)
+        VALUES (?, ?, ?, ?);
+    `
+
+	res, err := s.db.ExecContext(ctx, query, playlist.Name, playlist.URL, playlist.ArtworkURL, description)
+	if err != nil {
+		return store.CatalogEntry{}, fmt.Errorf("inserting catalog entry: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return store.CatalogEntry{}, fmt.Errorf("reading catalog entry id: %w", err)
+	}
+
+	entry, err := getCatalogEntry(ctx, s.db, id)
+	if err != nil {
+		return store.CatalogEntry{}, fmt.Errorf("reading inserted catalog entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+func (s *Store) ListCatalog(ctx context.Context) ([]store.CatalogEntry, error) {
+	const query = `
+        SELECT ` + catalogColumns + `
+        FROM catalog_entries
+        ORDER BY name ASC, id ASC;
+    `
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("fetching catalog: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	entries := make([]store.CatalogEntry, 0)
+	for rows.Next() {
+		entry, err := scanCatalogEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning catalog entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating catalog: %w", err)
+	}
+
+	return entries, nil
+}
+
+// DeleteCatalogEntry unpublishes an entry. Playlists already installed from
+// it stay on their devices.
+func (s *Store) DeleteCatalogEntry(ctx context.Context, entryID int64) error {
+	const query = `
+        DELETE FROM catalog_entries
+        WHERE id = ?;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, entryID)
+	if err != nil {
+		return fmt.Errorf("deleting catalog entry: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking delete result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.ErrCatalogNotFound
+	}
+
+	return nil
+}
+
+// InstallCatalogEntry adds a copy of a catalog entry to the device's
+// playlists, subject to the usual uniqueness rule and quota.
+func (s *Store) InstallCatalogEntry(ctx context.Context, deviceID string, entryID int64) (pl store.Playlist, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.Playlist{}, err
+	}
+
+	entry, err := getCatalogEntry(ctx, tx, entryID)
+	if err != nil {
+		return store.Playlist{}, err
+	}
+
+	if pl, err = s.insertPlaylist(ctx, tx, deviceID, store.NewPlaylist{Name: entry.Name, URL: entry.URL, ArtworkURL: entry.ArtworkURL}); err != nil {
+		return store.Playlist{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.Playlist{}, fmt.Errorf("committing catalog install: %w", err)
+	}
+
+	return pl, nil
+}
+
+func getCatalogEntry(ctx context.Context, q querier, entryID int64) (store.CatalogEntry, error) {
+	const query = `
+        SELECT ` + catalogColumns + `
+        FROM catalog_entries
+        WHERE id = ?;
+    `
+
+	entry, err := scanCatalogEntry(q.QueryRowContext(ctx, query, entryID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.CatalogEntry{}, store.ErrCatalogNotFound
+		}
+		return store.CatalogEntry{}, fmt.Errorf("fetching catalog entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+func scanCatalogEntry(row rowScanner) (store.CatalogEntry, error) {
+	var entry store.CatalogEntry
+
+	if err := row.Scan(&entry.ID, &entry.Name, &entry.URL, &entry.ArtworkURL, &entry.Description, &entry.CreatedAt); err != nil {
+		return store.CatalogEntry{}, err
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,240 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const commandColumns = `id, type, volume, playlist_id, status, error, created_at, expires_at, acknowledged_at, completed_at`
+
+// EnqueueCommand queues a command for the device. A switch-playlist command
+// must name one of the device's active playlists or one it inherits from a
+// group.
+func (s *Store) EnqueueCommand(ctx context.Context, deviceID string, cmd store.NewCommand) (result store.Command, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Command{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.Command{}, err
+	}
+
+	if cmd.PlaylistID != nil {
+		if _, err = getAvailablePlaylist(ctx, tx, deviceID, *cmd.PlaylistID); err != nil {
+			return store.Command{}, err
+		}
+	}
+
+	const insert = `
+        INSERT INTO device_commands (device_identifier, type, volume, playlist_id, expires_at)
+        VALUES (?, ?, ?, ?, ?);
+    `
+
+	res, err := tx.ExecContext(ctx, insert, deviceID, cmd.Type, cmd.Volume, cmd.PlaylistID, formatTimestamp(cmd.ExpiresAt))
+	if err != nil {
+		return store.Command{}, fmt.Errorf("queueing command: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return store.Command{}, fmt.Errorf("reading command id: %w", err)
+	}
+
+	if result, err = getCommand(ctx, tx, deviceID, id); err != nil {
+		return store.Command{}, fmt.Errorf("reading queued command: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.Command{}, fmt.Errorf("committing command: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetCommand returns one of the device's commands in any status.
+func (s *Store) GetCommand(ctx context.Context, deviceID string, commandID int64) (store.Command, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return store.Command{}, err
+	}
+
+	cmd, err := getCommand(ctx, s.db, deviceID, commandID)
+	if err != nil {
+		if errors.Is(err, store.ErrCommandNotFound) {
+			return store.Command{}, err
+		}
+		return store.Command{}, fmt.Errorf("fetching command: %w", err)
+	}
+
+	return cmd, nil
+}
+
+// PendingCommands returns the device's unacknowledged commands that have not
+// expired by now, oldest first. Commands stay pending until acknowledged, so
+// a device that loses a response receives them again on its next poll.
+func (s *Store) PendingCommands(ctx context.Context, deviceID string, now time.Time) ([]store.Command, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return nil, err
+	}
+
+	const query = `
+        SELECT ` + commandColumns + `
+        FROM device_commands
+        WHERE device_identifier = ? AND status = 'pending' AND expires_at > ?
+        ORDER BY id ASC;
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, deviceID, formatTimestamp(now))
+	if err != nil {
+		return nil, fmt.Errorf("fetching pending commands: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	commands := make([]store.Command, 0)
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning command: %w", err)
+		}
+		commands = append(commands, cmd)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating pending commands: %w", err)
+	}
+
+	return commands, nil
+}
+
+// AcknowledgeCommand records the device's report on a command. Delivery
+// can be acknowledged at any point and never moves a command backwards;
+// executed and failed are final, so reporting the other outcome afterwards
+// returns store.ErrCommandFinished. Repeating a report is harmless.
+func (s *Store) AcknowledgeCommand(ctx context.Context, deviceID string, commandID int64, ack store.CommandAck) (result store.Command, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Command{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.Command{}, err
+	}
+
+	current, err := getCommand(ctx, tx, deviceID, commandID)
+	if err != nil {
+		return store.Command{}, err
+	}
+
+	finished := current.Status == store.CommandExecuted || current.Status == store.CommandFailed
+	if finished && ack.Status != current.Status && ack.Status != store.CommandDelivered {
+		return store.Command{}, store.ErrCommandFinished
+	}
+
+	if ack.Status == current.Status || (ack.Status == store.CommandDelivered && current.Status != store.CommandPending) {
+		if err = tx.Commit(); err != nil {
+			return store.Command{}, fmt.Errorf("committing command acknowledgement: %w", err)
+		}
+		return current, nil
+	}
+
+	if ack.Status != store.CommandFailed {
+		ack.Error = ""
+	}
+
+	const update = `
+        UPDATE device_commands
+        SET status = ?,
+            error = ?,
+            acknowledged_at = COALESCE(acknowledged_at, CURRENT_TIMESTAMP),
+            completed_at = CASE WHEN ? THEN CURRENT_TIMESTAMP END
+        WHERE id = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, update, ack.Status, ack.Error, ack.Status != store.CommandDelivered, commandID); err != nil {
+		return store.Command{}, fmt.Errorf("acknowledging command: %w", err)
+	}
+
+	if result, err = getCommand(ctx, tx, deviceID, commandID); err != nil {
+		return store.Command{}, fmt.Errorf("reading acknowledged command: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.Command{}, fmt.Errorf("committing command acknowledgement: %w", err)
+	}
+
+	return result, nil
+}
+
+func getCommand(ctx context.Context, q querier, deviceID string, commandID int64) (store.Command, error) {
+	const query = `
+        SELECT ` + commandColumns + `
+        FROM device_commands
+        WHERE id = ? AND device_identifier = ?;
+    `
+
+	cmd, err := scanCommand(q.QueryRowContext(ctx, query, commandID, deviceID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Command{}, store.ErrCommandNotFound
+		}
+		return store.Command{}, err
+	}
+
+	return cmd, nil
+}
+
+func scanCommand(row rowScanner) (store.Command, error) {
+	var (
+		cmd            store.Command
+		volume         sql.NullInt64
+		playlistID     sql.NullInt64
+		acknowledgedAt sql.NullTime
+		completedAt    sql.NullTime
+	)
+
+	if err := row.Scan(&cmd.ID, &cmd.Type, &volume, &playlistID, &cmd.Status, &cmd.Error, &cmd.CreatedAt, &cmd.ExpiresAt, &acknowledgedAt, &completedAt); err != nil {
+		return store.Command{}, err
+	}
+
+	if volume.Valid {
+		level := int(volume.Int64)
+		cmd.Volume = &level
+	}
+	if playlistID.Valid {
+		cmd.PlaylistID = &playlistID.Int64
+	}
+	if acknowledgedAt.Valid {
+		cmd.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if completedAt.Valid {
+		cmd.CompletedAt = &completedAt.Time
+	}
+
+	return cmd, nil
+}
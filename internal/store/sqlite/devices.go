@@ -0,0 +1,506 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const deviceColumns = `d.id, d.device_identifier, d.created_at,
+            d.display_name, d.model, d.firmware_version,
+            d.last_seen_at, d.last_ip,
+            d.legal_hold_reason, d.legal_hold_at, d.playlist_order, d.archived_at,
+            (SELECT json_group_array(tag) FROM (
+                SELECT t.tag FROM device_tags t
+                WHERE t.device_identifier = d.device_identifier
+                ORDER BY t.tag
+            )),
+            (SELECT COUNT(*) FROM playlists p
+             WHERE p.device_identifier = d.device_identifier AND p.deleted_at IS NULL)`
+
+func (s *Store) GetDevice(ctx context.Context, deviceID string) (store.Device, error) {
+	return getDevice(ctx, s.db, deviceID)
+}
+
+func getDevice(ctx context.Context, q querier, deviceID string) (store.Device, error) {
+	const query = `
+        SELECT ` + deviceColumns + `
+        FROM devices d
+        WHERE d.device_identifier = ?;
+    `
+
+	d, _, err := scanDevice(q.QueryRowContext(ctx, query, deviceID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Device{}, store.ErrDeviceNotFound
+		}
+		return store.Device{}, fmt.Errorf("fetching device: %w", err)
+	}
+
+	return d, nil
+}
+
+func (s *Store) UpdateDevice(ctx context.Context, deviceID string, update store.DeviceUpdate) (d store.Device, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Device{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	const query = `
+        UPDATE devices
+        SET display_name = COALESCE(?, display_name),
+            model = COALESCE(?, model),
+            firmware_version = COALESCE(?, firmware_version),
+            playlist_order = COALESCE(?, playlist_order)
+        WHERE device_identifier = ?;
+    `
+
+	res, err := tx.ExecContext(ctx, query,
+		update.DisplayName, update.Model, update.FirmwareVersion, update.PlaylistOrder, deviceID,
+	)
+	if err != nil {
+		return store.Device{}, fmt.Errorf("updating device: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return store.Device{}, fmt.Errorf("checking update result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.Device{}, store.ErrDeviceNotFound
+	}
+
+	if update.Tags != nil {
+		if err = replaceDeviceTags(ctx, tx, deviceID, *update.Tags); err != nil {
+			return store.Device{}, err
+		}
+	}
+
+	if d, err = getDevice(ctx, tx, deviceID); err != nil {
+		return store.Device{}, fmt.Errorf("reading updated device: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.Device{}, fmt.Errorf("committing device update: %w", err)
+	}
+
+	return d, nil
+}
+
+func replaceDeviceTags(ctx context.Context, q querier, deviceID string, tags []string) error {
+	const clearTags = `
+        DELETE FROM device_tags
+        WHERE device_identifier = ?;
+    `
+
+	if _, err := q.ExecContext(ctx, clearTags, deviceID); err != nil {
+		return fmt.Errorf("clearing device tags: %w", err)
+	}
+
+	const insert = `
+        INSERT INTO device_tags (device_identifier, tag)
+        VALUES (?, ?)
+        ON CONFLICT(device_identifier, tag) DO NOTHING;
+    `
+
+	for _, tag := range tags {
+		if _, err := q.ExecContext(ctx, insert, deviceID, tag); err != nil {
+			return fmt.Errorf("inserting device tag: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RecordHeartbeat marks the device as seen now and stores the firmware
+// version and address it reported, if any.
+func (s *Store) RecordHeartbeat(ctx context.Context, deviceID string, hb store.Heartbeat) error {
+	const query = `
+        UPDATE devices
+        SET last_seen_at = CURRENT_TIMESTAMP,
+            archived_at = NULL,
+            archive_warned_at = NULL,
+            firmware_version = COALESCE(NULLIF(?, ''), firmware_version),
+            last_ip = COALESCE(NULLIF(?, ''), last_ip)
+        WHERE device_identifier = ?;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, hb.FirmwareVersion, hb.IP, deviceID)
+	if err != nil {
+		return fmt.Errorf("recording heartbeat: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking heartbeat result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// ListDevices pages through devices in registration order. Cursors are the
+// internal row id of the last device returned and are opaque to callers.
+func (s *Store) ListDevices(ctx context.Context, filter store.DeviceFilter) (store.DevicePage, error) {
+	var afterID int64
+	if filter.Cursor != "" {
+		id, err := strconv.ParseInt(filter.Cursor, 10, 64)
+		if err != nil || id < 0 {
+			return store.DevicePage{}, store.ErrInvalidCursor
+		}
+		afterID = id
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	conditions := []string{"d.id > ?"}
+	args := []any{afterID}
+
+	if filter.Archived {
+		conditions = append(conditions, "d.archived_at IS NOT NULL")
+	} else {
+		conditions = append(conditions, "d.archived_at IS NULL")
+	}
+
+	if filter.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM device_tags t WHERE t.device_identifier = d.device_identifier AND t.tag = ?)")
+		args = append(args, filter.Tag)
+	}
+	if !filter.SeenSince.IsZero() {
+		conditions = append(conditions, "d.last_seen_at >= ?")
+		args = append(args, formatTimestamp(filter.SeenSince))
+	}
+	if !filter.NotSeenSince.IsZero() {
+		conditions = append(conditions, "(d.last_seen_at IS NULL OR d.last_seen_at < ?)")
+		args = append(args, formatTimestamp(filter.NotSeenSince))
+	}
+
+	query := `
+        SELECT ` + deviceColumns + `
+        FROM devices d
+        WHERE ` + strings.Join(conditions, " AND ") + `
+        ORDER BY d.id ASC
+        LIMIT ?;
+    `
+	args = append(args, limit+1)
+
+	// Fetch one extra row to learn whether another page exists.
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return store.DevicePage{}, fmt.Errorf("fetching devices: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	var (
+		page   store.DevicePage
+		lastID int64
+	)
+	page.Devices = make([]store.Device, 0, limit)
+
+	for rows.Next() {
+		if len(page.Devices) == limit {
+			page.NextCursor = strconv.FormatInt(lastID, 10)
+			break
+		}
+
+		d, rowID, err := scanDevice(rows)
+		if err != nil {
+			return store.DevicePage{}, fmt.Errorf("scanning device: %w", err)
+		}
+		lastID = rowID
+		page.Devices = append(page.Devices, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return store.DevicePage{}, fmt.Errorf("iterating devices: %w", err)
+	}
+
+	return page, nil
+}
+
+// scanDevice reads a row selected with deviceColumns and also returns the
+// internal row id used for pagination.
+func scanDevice(row rowScanner) (store.Device, int64, error) {
+	var (
+		d          store.Device
+		rowID      int64
+		lastSeenAt sql.NullTime
+		holdReason string
+		holdAt     sql.NullTime
+		archivedAt sql.NullTime
+		tags       string
+	)
+
+	err := row.Scan(
+		&rowID, &d.ID, &d.CreatedAt,
+		&d.DisplayName, &d.Model, &d.FirmwareVersion,
+		&lastSeenAt, &d.LastIP,
+		&holdReason, &holdAt, &d.PlaylistOrder, &archivedAt,
+		&tags,
+		&d.PlaylistCount,
+	)
+	if err != nil {
+		return store.Device{}, 0, err
+	}
+	if err := json.Unmarshal([]byte(tags), &d.Tags); err != nil {
+		return store.Device{}, 0, fmt.Errorf("decoding device tags: %w", err)
+	}
+	if lastSeenAt.Valid {
+		d.LastSeenAt = &lastSeenAt.Time
+	}
+	d.LegalHold = scanLegalHold(holdReason, holdAt)
+	if archivedAt.Valid {
+		d.ArchivedAt = &archivedAt.Time
+	}
+
+	return d, rowID, nil
+}
+
+// RenameDevice moves a device and everything it owns to a new identifier in
+// one transaction, for players whose hardware ID changed after reflashing.
+// The device keeps its row, creation time and metadata.
+func (s *Store) RenameDevice(ctx context.Context, oldID, newID string) (d store.Device, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Device{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, oldID); err != nil {
+		return store.Device{}, err
+	}
+
+	err = ensureDevice(ctx, tx, newID)
+	switch {
+	case err == nil:
+		return store.Device{}, store.ErrDeviceExists
+	case !errors.Is(err, store.ErrDeviceNotFound):
+		return store.Device{}, err
+	}
+
+	// Child rows reference devices by identifier without ON UPDATE CASCADE,
+	// so foreign key checks are deferred to commit while both sides move.
+	if _, err = tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON;`); err != nil {
+		return store.Device{}, fmt.Errorf("deferring foreign keys: %w", err)
+	}
+
+	const renameDevice = `
+        UPDATE devices
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, renameDevice, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("renaming device: %w", err)
+	}
+
+	const movePlaylists = `
+        UPDATE playlists
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, movePlaylists, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("moving playlists: %w", err)
+	}
+
+	const moveMemberships = `
+        UPDATE device_group_members
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, moveMemberships, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("moving group memberships: %w", err)
+	}
+
+	const moveTags = `
+        UPDATE device_tags
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, moveTags, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("moving device tags: %w", err)
+	}
+
+	const movePlaybackPositions = `
+        UPDATE playback_positions
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, movePlaybackPositions, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("moving playback positions: %w", err)
+	}
+
+	const moveNowPlaying = `
+        UPDATE now_playing
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, moveNowPlaying, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("moving now playing state: %w", err)
+	}
+
+	const moveSettings = `
+        UPDATE device_settings
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, moveSettings, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("moving device settings: %w", err)
+	}
+
+	const movePlaybackEvents = `
+        UPDATE playback_events
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, movePlaybackEvents, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("moving playback history: %w", err)
+	}
+
+	const movePlaybackSessions = `
+        UPDATE playback_sessions
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, movePlaybackSessions, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("moving playback sessions: %w", err)
+	}
+
+	const moveCommands = `
+        UPDATE device_commands
+        SET device_identifier = ?
+        WHERE device_identifier = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, moveCommands, newID, oldID); err != nil {
+		return store.Device{}, fmt.Errorf("moving device commands: %w", err)
+	}
+
+	if d, err = getDevice(ctx, tx, newID); err != nil {
+		return store.Device{}, fmt.Errorf("reading renamed device: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.Device{}, fmt.Errorf("committing device rename: %w", err)
+	}
+
+	return d, nil
+}
+
+// DeleteDevice removes a device; its playlists follow through ON DELETE
+// CASCADE. Playback history outlives the device unless purge is set. A legal
+// hold on the device or any of its playlists blocks the deletion.
+func (s *Store) DeleteDevice(ctx context.Context, deviceID string, purge bool) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	const query = `
+        DELETE FROM devices
+        WHERE device_identifier = ? AND legal_hold_at IS NULL
+          AND NOT EXISTS (
+              SELECT 1 FROM playlists p
+              WHERE p.device_identifier = devices.device_identifier AND p.legal_hold_at IS NOT NULL
+          );
+    `
+
+	res, err := tx.ExecContext(ctx, query, deviceID)
+	if err != nil {
+		return fmt.Errorf("deleting device: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking delete result: %w", err)
+	}
+
+	if affected == 0 {
+		if err = ensureDevice(ctx, tx, deviceID); err != nil {
+			return err
+		}
+		return store.ErrLegalHold
+	}
+
+	if purge {
+		const purgeHistory = `
+            DELETE FROM playback_events
+            WHERE device_identifier = ?;
+        `
+
+		if _, err = tx.ExecContext(ctx, purgeHistory, deviceID); err != nil {
+			return fmt.Errorf("purging playback history: %w", err)
+		}
+
+		const purgeSessions = `
+            DELETE FROM playback_sessions
+            WHERE device_identifier = ?;
+        `
+
+		if _, err = tx.ExecContext(ctx, purgeSessions, deviceID); err != nil {
+			return fmt.Errorf("purging playback sessions: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing device deletion: %w", err)
+	}
+
+	return nil
+}
+
+// formatTimestamp renders t the way CURRENT_TIMESTAMP stores it, so the two
+// compare correctly as text.
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.DateTime)
+}
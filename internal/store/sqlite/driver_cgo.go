@@ -0,0 +1,15 @@
+//go:build !purego
+
+package sqlite
+
+import (
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const driverName = "sqlite3"
+
+func dsn(dbPath string) string {
+	return fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", dbPath)
+}
@@ -0,0 +1,17 @@
+//go:build purego
+
+package sqlite
+
+import (
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// driverName selects modernc.org/sqlite, a CGO-free port of SQLite, when the
+// server is built with -tags purego.
+const driverName = "sqlite"
+
+func dsn(dbPath string) string {
+	return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", dbPath)
+}
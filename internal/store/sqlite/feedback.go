@@ -0,0 +1,61 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+// RecordTrackFeedback appends a feedback event for a track. Events are kept
+// individually so they can later be weighted by time.
+func (s *Store) RecordTrackFeedback(ctx context.Context, deviceID string, playlistID, trackID int64, event store.FeedbackEvent) error {
+	if err := ensurePlaylist(ctx, s.db, deviceID, playlistID); err != nil {
+		return err
+	}
+
+	if _, err := getTrack(ctx, s.db, playlistID, trackID); err != nil {
+		return err
+	}
+
+	const query = `
+        INSERT INTO track_feedback (track_id, event)
+        VALUES (?, ?);
+    `
+
+	if _, err := s.db.ExecContext(ctx, query, trackID, string(event)); err != nil {
+		return fmt.Errorf("inserting track feedback: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) GetTrackFeedback(ctx context.Context, deviceID string, playlistID, trackID int64) (store.TrackFeedback, error) {
+	if err := ensurePlaylist(ctx, s.db, deviceID, playlistID); err != nil {
+		return store.TrackFeedback{}, err
+	}
+
+	if _, err := getTrack(ctx, s.db, playlistID, trackID); err != nil {
+		return store.TrackFeedback{}, err
+	}
+
+	const query = `
+        SELECT
+            COALESCE(SUM(event = ?), 0),
+            COALESCE(SUM(event = ?), 0),
+            COALESCE(SUM(event = ?), 0)
+        FROM track_feedback
+        WHERE track_id = ?;
+    `
+
+	var fb store.TrackFeedback
+	err := s.db.QueryRowContext(ctx, query,
+		string(store.FeedbackLike), string(store.FeedbackDislike), string(store.FeedbackSkip),
+		trackID,
+	).Scan(&fb.Likes, &fb.Dislikes, &fb.Skips)
+	if err != nil {
+		return store.TrackFeedback{}, fmt.Errorf("counting track feedback: %w", err)
+	}
+
+	return fb, nil
+}
@@ -0,0 +1,406 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+const groupColumns = `g.id, g.name, g.created_at,
+            (SELECT COUNT(*) FROM device_group_members m WHERE m.group_id = g.id)`
+
+const groupPlaylistColumns = `gp.id, gp.group_id, gp.name, gp.url, gp.artwork_url, gp.position, gp.created_at`
+
+func (s *Store) CreateGroup(ctx context.Context, name string) (store.Group, error) {
+	const query = `
+        INSERT INTO device_groups (name)
+        VALUES (?)
+        ON CONFLICT(name) DO NOTHING;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, name)
+	if err != nil {
+		return store.Group{}, fmt.Errorf("inserting group: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return store.Group{}, fmt.Errorf("checking insert result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.Group{}, store.ErrGroupExists
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return store.Group{}, fmt.Errorf("reading group id: %w", err)
+	}
+
+	return s.GetGroup(ctx, id)
+}
+
+func (s *Store) GetGroup(ctx context.Context, groupID int64) (store.Group, error) {
+	const query = `
+        SELECT ` + groupColumns + `
+        FROM device_groups g
+        WHERE g.id = ?;
+    `
+
+	g, err := scanGroup(s.db.QueryRowContext(ctx, query, groupID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Group{}, store.ErrGroupNotFound
+		}
+		return store.Group{}, fmt.Errorf("fetching group: %w", err)
+	}
+
+	return g, nil
+}
+
+func (s *Store) ListGroups(ctx context.Context) ([]store.Group, error) {
+	const query = `
+        SELECT ` + groupColumns + `
+        FROM device_groups g
+        ORDER BY g.name ASC;
+    `
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("fetching groups: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	groups := make([]store.Group, 0)
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating groups: %w", err)
+	}
+
+	return groups, nil
+}
+
+// DeleteGroup removes a group, its memberships and its playlists, with
+// their tracks. Member devices keep their own playlists.
+func (s *Store) DeleteGroup(ctx context.Context, groupID int64) error {
+	const query = `
+        DELETE FROM device_groups
+        WHERE id = ?;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, groupID)
+	if err != nil {
+		return fmt.Errorf("deleting group: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking delete result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.ErrGroupNotFound
+	}
+
+	return nil
+}
+
+// AddGroupDevice makes a device a member of a group. Adding an existing
+// member is a no-op.
+func (s *Store) AddGroupDevice(ctx context.Context, groupID int64, deviceID string) error {
+	if err := ensureGroup(ctx, s.db, groupID); err != nil {
+		return err
+	}
+
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return err
+	}
+
+	const query = `
+        INSERT INTO device_group_members (group_id, device_identifier)
+        VALUES (?, ?)
+        ON CONFLICT(group_id, device_identifier) DO NOTHING;
+    `
+
+	if _, err := s.db.ExecContext(ctx, query, groupID, deviceID); err != nil {
+		return fmt.Errorf("adding group member: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) RemoveGroupDevice(ctx context.Context, groupID int64, deviceID string) error {
+	if err := ensureGroup(ctx, s.db, groupID); err != nil {
+		return err
+	}
+
+	const query = `
+        DELETE FROM device_group_members
+        WHERE group_id = ? AND device_identifier = ?;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, groupID, deviceID)
+	if err != nil {
+		return fmt.Errorf("removing group member: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking delete result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) ListGroupDevices(ctx context.Context, groupID int64) ([]string, error) {
+	if err := ensureGroup(ctx, s.db, groupID); err != nil {
+		return nil, err
+	}
+
+	const query = `
+        SELECT device_identifier
+        FROM device_group_members
+        WHERE group_id = ?
+        ORDER BY device_identifier ASC;
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching group members: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	deviceIDs := make([]string, 0)
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, fmt.Errorf("scanning group member: %w", err)
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating group members: %w", err)
+	}
+
+	return deviceIDs, nil
+}
+
+// AddGroupPlaylist appends a playlist to the group's list. Group playlists
+// are not subject to the per-device uniqueness rule or quota. They live in
+// the playlists table, so their IDs never coincide with a device playlist's.
+func (s *Store) AddGroupPlaylist(ctx context.Context, groupID int64, playlist store.NewPlaylist) (store.Playlist, error) {
+	if err := ensureGroup(ctx, s.db, groupID); err != nil {
+		return store.Playlist{}, err
+	}
+
+	const query = `
+        INSERT INTO playlists (group_id, name, url, artwork_url, position)
+        VALUES (?, ?, ?, ?, (
+            SELECT COALESCE(MAX(position), 0) + 1 FROM playlists
+            WHERE group_id = ?
+        ));
+    `
+
+	res, err := s.db.ExecContext(ctx, query, groupID, playlist.Name, playlist.URL, playlist.ArtworkURL, groupID)
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("inserting group playlist: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("reading playlist id: %w", err)
+	}
+
+	const read = `
+        SELECT ` + groupPlaylistColumns + `
+        FROM playlists gp
+        WHERE gp.id = ?;
+    `
+
+	pl, err := scanGroupPlaylist(s.db.QueryRowContext(ctx, read, id))
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("reading inserted group playlist: %w", err)
+	}
+
+	return pl, nil
+}
+
+func (s *Store) ListGroupPlaylists(ctx context.Context, groupID int64) ([]store.Playlist, error) {
+	if err := ensureGroup(ctx, s.db, groupID); err != nil {
+		return nil, err
+	}
+
+	const query = `
+        SELECT ` + groupPlaylistColumns + `
+        FROM playlists gp
+        WHERE gp.group_id = ?
+        ORDER BY gp.position ASC, gp.id ASC;
+    `
+
+	return queryGroupPlaylists(ctx, s.db, query, groupID)
+}
+
+func (s *Store) DeleteGroupPlaylist(ctx context.Context, groupID, playlistID int64) error {
+	if err := ensureGroup(ctx, s.db, groupID); err != nil {
+		return err
+	}
+
+	const query = `
+        DELETE FROM playlists
+        WHERE id = ? AND group_id = ?;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, playlistID, groupID)
+	if err != nil {
+		return fmt.Errorf("deleting group playlist: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking delete result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.ErrPlaylistNotFound
+	}
+
+	return nil
+}
+
+// ListInheritedPlaylists returns the playlists a device receives through its
+// groups, ordered by group and then by position within each group.
+func (s *Store) ListInheritedPlaylists(ctx context.Context, deviceID string) ([]store.Playlist, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return nil, err
+	}
+
+	const query = `
+        SELECT ` + groupPlaylistColumns + `
+        FROM playlists gp
+        JOIN device_group_members m ON m.group_id = gp.group_id
+        WHERE m.device_identifier = ?
+        ORDER BY gp.group_id ASC, gp.position ASC, gp.id ASC;
+    `
+
+	return queryGroupPlaylists(ctx, s.db, query, deviceID)
+}
+
+func queryGroupPlaylists(ctx context.Context, q querier, query string, args ...any) ([]store.Playlist, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching group playlists: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	playlists := make([]store.Playlist, 0)
+	for rows.Next() {
+		pl, err := scanGroupPlaylist(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning group playlist: %w", err)
+		}
+		playlists = append(playlists, pl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating group playlists: %w", err)
+	}
+
+	return playlists, nil
+}
+
+// getAvailablePlaylist returns a playlist the device can play: one of its
+// own active playlists or one it inherits from a group.
+func getAvailablePlaylist(ctx context.Context, q querier, deviceID string, playlistID int64) (store.Playlist, error) {
+	const query = `
+        SELECT ` + groupPlaylistColumns + `
+        FROM playlists gp
+        WHERE gp.id = ?
+          AND ((gp.device_identifier = ? AND gp.deleted_at IS NULL)
+            OR gp.group_id IN (SELECT m.group_id FROM device_group_members m WHERE m.device_identifier = ?));
+    `
+
+	pl, err := scanGroupPlaylist(q.QueryRowContext(ctx, query, playlistID, deviceID, deviceID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Playlist{}, store.ErrPlaylistNotFound
+		}
+		return store.Playlist{}, err
+	}
+
+	return pl, nil
+}
+
+func ensureGroup(ctx context.Context, q querier, groupID int64) error {
+	const groupCheck = `
+        SELECT 1 FROM device_groups WHERE id = ?;
+    `
+
+	if err := q.QueryRowContext(ctx, groupCheck, groupID).Scan(new(int)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.ErrGroupNotFound
+		}
+		return fmt.Errorf("checking group existence: %w", err)
+	}
+
+	return nil
+}
+
+func scanGroup(row rowScanner) (store.Group, error) {
+	var g store.Group
+
+	if err := row.Scan(&g.ID, &g.Name, &g.CreatedAt, &g.DeviceCount); err != nil {
+		return store.Group{}, err
+	}
+
+	return g, nil
+}
+
+// scanGroupPlaylist reads a row selected with groupPlaylistColumns. Group
+// playlists are not edited in place, so UpdatedAt is their creation time.
+// GroupID is zero for a device's own playlist.
+func scanGroupPlaylist(row rowScanner) (store.Playlist, error) {
+	var (
+		pl      store.Playlist
+		groupID sql.NullInt64
+	)
+
+	if err := row.Scan(&pl.ID, &groupID, &pl.Name, &pl.URL, &pl.ArtworkURL, &pl.Position, &pl.CreatedAt); err != nil {
+		return store.Playlist{}, err
+	}
+
+	pl.GroupID = groupID.Int64
+
+	pl.UpdatedAt = pl.CreatedAt
+
+	return pl, nil
+}
@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+// ImportDevices creates devices, playlists and tracks in one transaction, so
+// a failed import leaves nothing behind. Exceeding the playlist quota fails
+// the whole import.
+func (s *Store) ImportDevices(ctx context.Context, devices []store.ImportedDevice) (summary store.ImportSummary, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.ImportSummary{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	const insertDevice = `
+        INSERT INTO devices (device_identifier, display_name, model, firmware_version)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT(device_identifier) DO NOTHING;
+    `
+
+	const insertTrack = `
+        INSERT INTO tracks (playlist_id, url, content_hash, title, artist, album, duration_seconds, mime_type, artwork_url, position)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+    `
+
+	for _, device := range devices {
+		res, err := tx.ExecContext(ctx, insertDevice, device.ID, device.DisplayName, device.Model, device.FirmwareVersion)
+		if err != nil {
+			return store.ImportSummary{}, fmt.Errorf("importing device %s: %w", device.ID, err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return store.ImportSummary{}, fmt.Errorf("checking device import result: %w", err)
+		}
+
+		if affected > 0 {
+			summary.DevicesCreated++
+		} else {
+			summary.DevicesExisting++
+		}
+
+		for _, playlist := range device.Playlists {
+			pl, err := s.insertPlaylist(ctx, tx, device.ID, playlist.NewPlaylist)
+			if errors.Is(err, store.ErrDuplicatePlaylist) {
+				summary.PlaylistsSkipped++
+				continue
+			}
+			if err != nil {
+				return store.ImportSummary{}, fmt.Errorf("importing playlist %q for device %s: %w", playlist.Name, device.ID, err)
+			}
+			summary.PlaylistsCreated++
+
+			for i, track := range playlist.Tracks {
+				_, err = tx.ExecContext(ctx, insertTrack,
+					pl.ID, track.URL, track.ContentHash,
+					track.Title, track.Artist, track.Album, track.DurationSeconds, track.MimeType, track.ArtworkURL,
+					i+1,
+				)
+				if err != nil {
+					return store.ImportSummary{}, fmt.Errorf("importing track: %w", err)
+				}
+			}
+			summary.TracksCreated += len(playlist.Tracks)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.ImportSummary{}, fmt.Errorf("committing import: %w", err)
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+// playlistNotHeld guards statements on the playlists table that delete rows,
+// so a hold placed concurrently cannot be bypassed between check and write.
+const playlistNotHeld = `legal_hold_at IS NULL
+          AND NOT EXISTS (
+              SELECT 1 FROM devices d
+              WHERE d.device_identifier = playlists.device_identifier AND d.legal_hold_at IS NOT NULL
+          )`
+
+// SetDeviceLegalHold places a hold on a device, or releases it when hold is
+// nil. Placing a hold again replaces the reason and time.
+func (s *Store) SetDeviceLegalHold(ctx context.Context, deviceID string, hold *store.LegalHold) error {
+	const query = `
+        UPDATE devices
+        SET legal_hold_reason = ?, legal_hold_at = ?
+        WHERE device_identifier = ?;
+    `
+
+	reason, placedAt := legalHoldArgs(hold)
+
+	res, err := s.db.ExecContext(ctx, query, reason, placedAt, deviceID)
+	if err != nil {
+		return fmt.Errorf("updating device legal hold: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking legal hold result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// SetPlaylistLegalHold places or releases a hold on a playlist. Playlists in
+// the trash can be held too, which keeps them from being purged.
+func (s *Store) SetPlaylistLegalHold(ctx context.Context, deviceID string, playlistID int64, hold *store.LegalHold) error {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return err
+	}
+
+	const query = `
+        UPDATE playlists
+        SET legal_hold_reason = ?, legal_hold_at = ?
+        WHERE id = ? AND device_identifier = ?;
+    `
+
+	reason, placedAt := legalHoldArgs(hold)
+
+	res, err := s.db.ExecContext(ctx, query, reason, placedAt, playlistID, deviceID)
+	if err != nil {
+		return fmt.Errorf("updating playlist legal hold: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking legal hold result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.ErrPlaylistNotFound
+	}
+
+	return nil
+}
+
+// ensurePlaylistNotHeld returns ErrLegalHold when the playlist or its device
+// is held. Changing or removing a held playlist's tracks would destroy what
+// the hold preserves, so it is checked inside the transaction doing so.
+func ensurePlaylistNotHeld(ctx context.Context, q querier, playlistID int64) error {
+	const query = `
+        SELECT 1 FROM playlists
+        WHERE id = ?
+          AND ` + playlistNotHeld + `;
+    `
+
+	if err := q.QueryRowContext(ctx, query, playlistID).Scan(new(int)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.ErrLegalHold
+		}
+		return fmt.Errorf("checking playlist legal hold: %w", err)
+	}
+
+	return nil
+}
+
+// playlistHoldError explains why a guarded delete touched no rows: either the
+// playlist does not exist (in the trash or not, per activeOnly) or a hold
+// covers it.
+func playlistHoldError(ctx context.Context, q querier, deviceID string, playlistID int64, activeOnly bool) error {
+	query := `
+        SELECT 1 FROM playlists
+        WHERE id = ? AND device_identifier = ?`
+	if activeOnly {
+		query += ` AND deleted_at IS NULL`
+	}
+
+	if err := q.QueryRowContext(ctx, query, playlistID, deviceID).Scan(new(int)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.ErrPlaylistNotFound
+		}
+		return fmt.Errorf("checking playlist existence: %w", err)
+	}
+
+	return store.ErrLegalHold
+}
+
+func legalHoldArgs(hold *store.LegalHold) (string, any) {
+	if hold == nil {
+		return "", nil
+	}
+	return hold.Reason, formatTimestamp(hold.PlacedAt)
+}
+
+func scanLegalHold(reason string, placedAt sql.NullTime) *store.LegalHold {
+	if !placedAt.Valid {
+		return nil
+	}
+	return &store.LegalHold{Reason: reason, PlacedAt: placedAt.Time}
+}
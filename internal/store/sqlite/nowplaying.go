@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+// SetNowPlaying replaces the device's now-playing state. A report also counts
+// as the device being seen, like a heartbeat.
+func (s *Store) SetNowPlaying(ctx context.Context, deviceID string, np store.NowPlaying) (result store.NowPlaying, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.NowPlaying{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	const touchDevice = `
+        UPDATE devices
+        SET last_seen_at = CURRENT_TIMESTAMP,
+            archived_at = NULL,
+            archive_warned_at = NULL
+        WHERE device_identifier = ?;
+    `
+
+	res, err := tx.ExecContext(ctx, touchDevice, deviceID)
+	if err != nil {
+		return store.NowPlaying{}, fmt.Errorf("recording device activity: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return store.NowPlaying{}, fmt.Errorf("checking device activity result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.NowPlaying{}, store.ErrDeviceNotFound
+	}
+
+	const upsert = `
+        INSERT INTO now_playing (device_identifier, playlist_id, track_id, position_seconds)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT(device_identifier) DO UPDATE SET
+            playlist_id = excluded.playlist_id,
+            track_id = excluded.track_id,
+            position_seconds = excluded.position_seconds,
+            updated_at = CURRENT_TIMESTAMP;
+    `
+
+	if _, err = tx.ExecContext(ctx, upsert, deviceID, np.PlaylistID, np.TrackID, np.PositionSeconds); err != nil {
+		return store.NowPlaying{}, fmt.Errorf("storing now playing state: %w", err)
+	}
+
+	if result, err = getNowPlaying(ctx, tx, deviceID); err != nil {
+		return store.NowPlaying{}, fmt.Errorf("reading now playing state: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.NowPlaying{}, fmt.Errorf("committing now playing state: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetNowPlaying returns store.ErrNowPlayingUnset for a device that has never
+// reported.
+func (s *Store) GetNowPlaying(ctx context.Context, deviceID string) (store.NowPlaying, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return store.NowPlaying{}, err
+	}
+
+	np, err := getNowPlaying(ctx, s.db, deviceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.NowPlaying{}, store.ErrNowPlayingUnset
+		}
+		return store.NowPlaying{}, fmt.Errorf("fetching now playing state: %w", err)
+	}
+
+	return np, nil
+}
+
+func getNowPlaying(ctx context.Context, q querier, deviceID string) (store.NowPlaying, error) {
+	const query = `
+        SELECT playlist_id, track_id, position_seconds, updated_at
+        FROM now_playing
+        WHERE device_identifier = ?;
+    `
+
+	var (
+		np         store.NowPlaying
+		playlistID sql.NullInt64
+		trackID    sql.NullInt64
+	)
+
+	err := q.QueryRowContext(ctx, query, deviceID).Scan(&playlistID, &trackID, &np.PositionSeconds, &np.UpdatedAt)
+	if err != nil {
+		return store.NowPlaying{}, err
+	}
+
+	if playlistID.Valid {
+		np.PlaylistID = &playlistID.Int64
+	}
+	if trackID.Valid {
+		np.TrackID = &trackID.Int64
+	}
+
+	return np, nil
+}
@@ -0,0 +1,370 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const playbackPositionColumns = `pp.track_id, t.playlist_id, pp.position_seconds, pp.updated_at`
+
+// SavePlaybackPosition records where the device is in one of its own tracks,
+// replacing any earlier position for that track.
+func (s *Store) SavePlaybackPosition(ctx context.Context, deviceID string, trackID int64, positionSeconds int) (pos store.PlaybackPosition, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.PlaybackPosition{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.PlaybackPosition{}, err
+	}
+
+	const trackCheck = `
+        SELECT 1
+        FROM tracks t
+        JOIN playlists p ON p.id = t.playlist_id
+        WHERE t.id = ? AND p.device_identifier = ?;
+    `
+
+	if err = tx.QueryRowContext(ctx, trackCheck, trackID, deviceID).Scan(new(int)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.PlaybackPosition{}, store.ErrTrackNotFound
+		}
+		return store.PlaybackPosition{}, fmt.Errorf("checking track existence: %w", err)
+	}
+
+	const upsert = `
+        INSERT INTO playback_positions (device_identifier, track_id, position_seconds)
+        VALUES (?, ?, ?)
+        ON CONFLICT(device_identifier, track_id) DO UPDATE SET
+            position_seconds = excluded.position_seconds,
+            updated_at = CURRENT_TIMESTAMP;
+    `
+
+	if _, err = tx.ExecContext(ctx, upsert, deviceID, trackID, positionSeconds); err != nil {
+		return store.PlaybackPosition{}, fmt.Errorf("saving playback position: %w", err)
+	}
+
+	const read = `
+        SELECT ` + playbackPositionColumns + `
+        FROM playback_positions pp
+        JOIN tracks t ON t.id = pp.track_id
+        WHERE pp.device_identifier = ? AND pp.track_id = ?;
+    `
+
+	if pos, err = scanPlaybackPosition(tx.QueryRowContext(ctx, read, deviceID, trackID)); err != nil {
+		return store.PlaybackPosition{}, fmt.Errorf("reading playback position: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.PlaybackPosition{}, fmt.Errorf("committing playback position: %w", err)
+	}
+
+	return pos, nil
+}
+
+// ListPlaybackPositions returns the device's saved positions, most recently
+// saved first, so a device resuming after a power cycle can take the first.
+func (s *Store) ListPlaybackPositions(ctx context.Context, deviceID string) ([]store.PlaybackPosition, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return nil, err
+	}
+
+	const query = `
+        SELECT ` + playbackPositionColumns + `
+        FROM playback_positions pp
+        JOIN tracks t ON t.id = pp.track_id
+        WHERE pp.device_identifier = ?
+        ORDER BY pp.updated_at DESC, pp.track_id ASC;
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching playback positions: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	positions := make([]store.PlaybackPosition, 0)
+	for rows.Next() {
+		pos, err := scanPlaybackPosition(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning playback position: %w", err)
+		}
+		positions = append(positions, pos)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating playback positions: %w", err)
+	}
+
+	return positions, nil
+}
+
+func scanPlaybackPosition(row rowScanner) (store.PlaybackPosition, error) {
+	var pos store.PlaybackPosition
+
+	if err := row.Scan(&pos.TrackID, &pos.PlaylistID, &pos.PositionSeconds, &pos.UpdatedAt); err != nil {
+		return store.PlaybackPosition{}, err
+	}
+
+	return pos, nil
+}
+
+const playbackEventColumns = `id, track_id, playlist_id, title, artist, url, duration_seconds, started_at`
+
+// RecordPlaybackEvent adds a track start to the device's history. The track
+// must belong to one of the device's playlists.
+func (s *Store) RecordPlaybackEvent(ctx context.Context, deviceID string, trackID int64, startedAt time.Time) (event store.PlaybackEvent, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.PlaybackEvent{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.PlaybackEvent{}, err
+	}
+
+	const insert = `
+        INSERT INTO playback_events (device_identifier, track_id, playlist_id, title, artist, url, duration_seconds, started_at)
+        SELECT p.device_identifier, t.id, t.playlist_id, t.title, t.artist, t.url, t.duration_seconds, ?
+        FROM tracks t
+        JOIN playlists p ON p.id = t.playlist_id
+        WHERE t.id = ? AND p.device_identifier = ?;
+    `
+
+	res, err := tx.ExecContext(ctx, insert, formatTimestamp(startedAt), trackID, deviceID)
+	if err != nil {
+		return store.PlaybackEvent{}, fmt.Errorf("recording playback event: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return store.PlaybackEvent{}, fmt.Errorf("checking playback event result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.PlaybackEvent{}, store.ErrTrackNotFound
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return store.PlaybackEvent{}, fmt.Errorf("reading playback event id: %w", err)
+	}
+
+	const read = `
+        SELECT ` + playbackEventColumns + `
+        FROM playback_events
+        WHERE id = ?;
+    `
+
+	if event, err = scanPlaybackEvent(tx.QueryRowContext(ctx, read, id)); err != nil {
+		return store.PlaybackEvent{}, fmt.Errorf("reading playback event: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.PlaybackEvent{}, fmt.Errorf("committing playback event: %w", err)
+	}
+
+	return event, nil
+}
+
+// ListPlaybackEvents returns the device's history within the filter's range,
+// most recent first.
+func (s *Store) ListPlaybackEvents(ctx context.Context, deviceID string, filter store.PlaybackEventFilter) ([]store.PlaybackEvent, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"device_identifier = ?"}
+	args := []any{deviceID}
+
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "started_at >= ?")
+		args = append(args, formatTimestamp(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "started_at < ?")
+		args = append(args, formatTimestamp(filter.Until))
+	}
+
+	query := `
+        SELECT ` + playbackEventColumns + `
+        FROM playback_events
+        WHERE ` + strings.Join(conditions, " AND ") + `
+        ORDER BY started_at DESC, id DESC
+        LIMIT ?;
+    `
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching playback history: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	events := make([]store.PlaybackEvent, 0)
+	for rows.Next() {
+		event, err := scanPlaybackEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning playback event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating playback history: %w", err)
+	}
+
+	return events, nil
+}
+
+func scanPlaybackEvent(row rowScanner) (store.PlaybackEvent, error) {
+	var (
+		event      store.PlaybackEvent
+		trackID    sql.NullInt64
+		playlistID sql.NullInt64
+		duration   sql.NullInt64
+	)
+
+	if err := row.Scan(&event.ID, &trackID, &playlistID, &event.Title, &event.Artist, &event.URL, &duration, &event.StartedAt); err != nil {
+		return store.PlaybackEvent{}, err
+	}
+
+	if trackID.Valid {
+		event.TrackID = &trackID.Int64
+	}
+	if playlistID.Valid {
+		event.PlaylistID = &playlistID.Int64
+	}
+	if duration.Valid {
+		seconds := int(duration.Int64)
+		event.DurationSeconds = &seconds
+	}
+
+	return event, nil
+}
+
+// GetPlaybackStats aggregates the device's playback history between since
+// (inclusive) and until (exclusive); zero values leave that end open. The
+// next start is looked up across the whole history, so a play just before
+// until is still cut short by a track started after it. Session totals come
+// from the sessions started in the same range.
+func (s *Store) GetPlaybackStats(ctx context.Context, deviceID string, since, until time.Time) (store.PlaybackStats, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return store.PlaybackStats{}, err
+	}
+
+	var conditions []string
+	args := []any{deviceID}
+
+	if !since.IsZero() {
+		conditions = append(conditions, "e.started_at >= ?")
+		args = append(args, formatTimestamp(since))
+	}
+	if !until.IsZero() {
+		conditions = append(conditions, "e.started_at < ?")
+		args = append(args, formatTimestamp(until))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := `
+        WITH timeline AS (
+            SELECT playlist_id, duration_seconds, started_at,
+                   LEAD(started_at) OVER (ORDER BY started_at, id) AS next_started_at
+            FROM playback_events
+            WHERE device_identifier = ?
+        ),
+        plays AS (
+            SELECT e.playlist_id,
+                   CASE
+                       WHEN e.next_started_at IS NULL THEN e.duration_seconds
+                       ELSE MIN(e.duration_seconds,
+                                strftime('%s', e.next_started_at) - strftime('%s', e.started_at))
+                   END AS listen_seconds
+            FROM timeline e
+            ` + where + `
+        )
+        SELECT plays.playlist_id, COALESCE(p.name, ''), COUNT(*), COALESCE(SUM(plays.listen_seconds), 0)
+        FROM plays
+        LEFT JOIN playlists p ON p.id = plays.playlist_id
+        GROUP BY plays.playlist_id
+        ORDER BY COUNT(*) DESC, plays.playlist_id IS NULL, plays.playlist_id ASC;
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return store.PlaybackStats{}, fmt.Errorf("aggregating playback history: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	stats := store.PlaybackStats{Playlists: make([]store.PlaylistPlayStats, 0)}
+	for rows.Next() {
+		var (
+			entry      store.PlaylistPlayStats
+			playlistID sql.NullInt64
+		)
+
+		if err := rows.Scan(&playlistID, &entry.Name, &entry.Plays, &entry.ListenSeconds); err != nil {
+			return store.PlaybackStats{}, fmt.Errorf("scanning playback stats: %w", err)
+		}
+
+		if playlistID.Valid {
+			entry.PlaylistID = &playlistID.Int64
+		}
+
+		stats.TotalPlays += entry.Plays
+		stats.TotalListenSeconds += entry.ListenSeconds
+		stats.Playlists = append(stats.Playlists, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return store.PlaybackStats{}, fmt.Errorf("iterating playback stats: %w", err)
+	}
+
+	if err := addSessionStats(ctx, s.db, deviceID, since, until, &stats); err != nil {
+		return store.PlaybackStats{}, err
+	}
+
+	return stats, nil
+}
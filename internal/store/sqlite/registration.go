@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+// CreateRegistrationToken stores a provisioning token by its hash. The
+// plaintext token is only ever known to the caller.
+func (s *Store) CreateRegistrationToken(ctx context.Context, tokenHash string, expiresAt time.Time) error {
+	const query = `
+        INSERT INTO registration_tokens (token_hash, expires_at)
+        VALUES (?, ?);
+    `
+
+	if _, err := s.db.ExecContext(ctx, query, tokenHash, formatTimestamp(expiresAt)); err != nil {
+		return fmt.Errorf("inserting registration token: %w", err)
+	}
+
+	return nil
+}
+
+// RegisterDevice spends an unused, unexpired registration token and creates
+// the device in the same transaction. A token registers exactly one new
+// device; it cannot be spent on an identifier that already exists.
+func (s *Store) RegisterDevice(ctx context.Context, tokenHash, deviceID string, meta store.DeviceMetadata) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	const spendToken = `
+        UPDATE registration_tokens
+        SET used_at = CURRENT_TIMESTAMP, device_identifier = ?
+        WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?;
+    `
+
+	res, err := tx.ExecContext(ctx, spendToken, deviceID, tokenHash, formatTimestamp(time.Now()))
+	if err != nil {
+		return fmt.Errorf("spending registration token: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking token result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.ErrInvalidRegistrationToken
+	}
+
+	err = ensureDevice(ctx, tx, deviceID)
+	switch {
+	case err == nil:
+		return store.ErrDeviceExists
+	case !errors.Is(err, store.ErrDeviceNotFound):
+		return err
+	}
+
+	const insertDevice = `
+        INSERT INTO devices (device_identifier, display_name, model, firmware_version)
+        VALUES (?, ?, ?, ?);
+    `
+
+	if _, err = tx.ExecContext(ctx, insertDevice, deviceID, meta.DisplayName, meta.Model, meta.FirmwareVersion); err != nil {
+		return fmt.Errorf("inserting device: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing device registration: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+const playbackSessionColumns = `id, playlist_id, playlist_name, started_at, ended_at, end_reason`
+
+// sessionLastActive is when the device behind an open session last showed
+// signs of life: its last heartbeat, or the session start if that is later
+// or the device is gone.
+const sessionLastActive = `MAX(s.started_at, COALESCE(
+            (SELECT d.last_seen_at FROM devices d WHERE d.device_identifier = s.device_identifier),
+            s.started_at))`
+
+// OpenPlaybackSession starts a session on one of the device's active
+// playlists or one it inherits from a group. A device plays one thing at a
+// time, so any session it still has open is closed as replaced. Opening a
+// session counts as the device being seen, like a heartbeat.
+func (s *Store) OpenPlaybackSession(ctx context.Context, deviceID string, playlistID int64) (session store.PlaybackSession, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	const touchDevice = `
+        UPDATE devices
+        SET last_seen_at = CURRENT_TIMESTAMP,
+            archived_at = NULL,
+            archive_warned_at = NULL
+        WHERE device_identifier = ?;
+    `
+
+	res, err := tx.ExecContext(ctx, touchDevice, deviceID)
+	if err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("recording device activity: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("checking device activity result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.PlaybackSession{}, store.ErrDeviceNotFound
+	}
+
+	pl, err := getAvailablePlaylist(ctx, tx, deviceID, playlistID)
+	if err != nil {
+		return store.PlaybackSession{}, err
+	}
+
+	const closeOpen = `
+        UPDATE playback_sessions
+        SET ended_at = CURRENT_TIMESTAMP,
+            end_reason = ?
+        WHERE device_identifier = ? AND ended_at IS NULL;
+    `
+
+	if _, err = tx.ExecContext(ctx, closeOpen, store.SessionReplaced, deviceID); err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("closing previous playback session: %w", err)
+	}
+
+	const insert = `
+        INSERT INTO playback_sessions (device_identifier, playlist_id, playlist_name)
+        VALUES (?, ?, ?);
+    `
+
+	res, err = tx.ExecContext(ctx, insert, deviceID, pl.ID, pl.Name)
+	if err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("opening playback session: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("reading playback session id: %w", err)
+	}
+
+	if session, err = getPlaybackSession(ctx, tx, deviceID, id); err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("reading playback session: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("committing playback session: %w", err)
+	}
+
+	return session, nil
+}
+
+// ClosePlaybackSession ends one of the device's sessions now. Closing a
+// session that has already ended returns it unchanged, so a device retrying
+// after a lost response, or closing after a timeout, does no harm.
+func (s *Store) ClosePlaybackSession(ctx context.Context, deviceID string, sessionID int64) (session store.PlaybackSession, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.PlaybackSession{}, err
+	}
+
+	const update = `
+        UPDATE playback_sessions
+        SET ended_at = CURRENT_TIMESTAMP,
+            end_reason = ?
+        WHERE id = ? AND device_identifier = ? AND ended_at IS NULL;
+    `
+
+	if _, err = tx.ExecContext(ctx, update, store.SessionClosed, sessionID, deviceID); err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("closing playback session: %w", err)
+	}
+
+	if session, err = getPlaybackSession(ctx, tx, deviceID, sessionID); err != nil {
+		return store.PlaybackSession{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.PlaybackSession{}, fmt.Errorf("committing playback session: %w", err)
+	}
+
+	return session, nil
+}
+
+// ListPlaybackSessions returns the device's sessions started within the
+// filter's range, most recent first.
+func (s *Store) ListPlaybackSessions(ctx context.Context, deviceID string, filter store.PlaybackEventFilter) ([]store.PlaybackSession, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"device_identifier = ?"}
+	args := []any{deviceID}
+
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "started_at >= ?")
+		args = append(args, formatTimestamp(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "started_at < ?")
+		args = append(args, formatTimestamp(filter.Until))
+	}
+
+	query := `
+        SELECT ` + playbackSessionColumns + `
+        FROM playback_sessions
+        WHERE ` + strings.Join(conditions, " AND ") + `
+        ORDER BY started_at DESC, id DESC
+        LIMIT ?;
+    `
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching playback sessions: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	sessions := make([]store.PlaybackSession, 0)
+	for rows.Next() {
+		session, err := scanPlaybackSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning playback session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating playback sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// CloseStaleSessions closes open sessions whose device has not been seen
+// since seenBefore. They end at the device's last heartbeat rather than now,
+// so a device that crashed mid-play is not credited with the time it was
+// down.
+func (s *Store) CloseStaleSessions(ctx context.Context, seenBefore time.Time) (int, error) {
+	const query = `
+        UPDATE playback_sessions AS s
+        SET ended_at = ` + sessionLastActive + `,
+            end_reason = ?
+        WHERE s.ended_at IS NULL AND ` + sessionLastActive + ` < ?;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, store.SessionTimedOut, formatTimestamp(seenBefore))
+	if err != nil {
+		return 0, fmt.Errorf("closing stale playback sessions: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking stale playback sessions result: %w", err)
+	}
+
+	return int(affected), nil
+}
+
+// addSessionStats merges the device's session totals for sessions started
+// between since and until into stats. Open sessions count up to now.
+func addSessionStats(ctx context.Context, q querier, deviceID string, since, until time.Time, stats *store.PlaybackStats) error {
+	conditions := []string{"s.device_identifier = ?"}
+	args := []any{deviceID}
+
+	if !since.IsZero() {
+		conditions = append(conditions, "s.started_at >= ?")
+		args = append(args, formatTimestamp(since))
+	}
+	if !until.IsZero() {
+		conditions = append(conditions, "s.started_at < ?")
+		args = append(args, formatTimestamp(until))
+	}
+
+	query := `
+        SELECT s.playlist_id, COALESCE(p.name, MAX(s.playlist_name)), COUNT(*),
+               COALESCE(SUM(strftime('%s', COALESCE(s.ended_at, CURRENT_TIMESTAMP)) - strftime('%s', s.started_at)), 0)
+        FROM playback_sessions s
+        LEFT JOIN playlists p ON p.id = s.playlist_id
+        WHERE ` + strings.Join(conditions, " AND ") + `
+        GROUP BY s.playlist_id
+        ORDER BY COUNT(*) DESC, s.playlist_id IS NULL, s.playlist_id ASC;
+    `
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("aggregating playback sessions: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	for rows.Next() {
+		var (
+			playlistID sql.NullInt64
+			name       string
+			sessions   int
+			seconds    int
+		)
+
+		if err := rows.Scan(&playlistID, &name, &sessions, &seconds); err != nil {
+			return fmt.Errorf("scanning session stats: %w", err)
+		}
+
+		stats.TotalSessions += sessions
+		stats.TotalSessionSeconds += seconds
+
+		entry := findPlaylistStats(stats.Playlists, playlistID)
+		if entry == nil {
+			added := store.PlaylistPlayStats{Name: name}
+			if playlistID.Valid {
+				added.PlaylistID = &playlistID.Int64
+			}
+			stats.Playlists = append(stats.Playlists, added)
+			entry = &stats.Playlists[len(stats.Playlists)-1]
+		}
+
+		entry.Sessions = sessions
+		entry.SessionSeconds = seconds
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating session stats: %w", err)
+	}
+
+	return nil
+}
+
+func findPlaylistStats(entries []store.PlaylistPlayStats, playlistID sql.NullInt64) *store.PlaylistPlayStats {
+	for i := range entries {
+		id := entries[i].PlaylistID
+		if (id == nil && !playlistID.Valid) || (id != nil && playlistID.Valid && *id == playlistID.Int64) {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func getPlaybackSession(ctx context.Context, q querier, deviceID string, sessionID int64) (store.PlaybackSession, error) {
+	const query = `
+        SELECT ` + playbackSessionColumns + `
+        FROM playback_sessions
+        WHERE id = ? AND device_identifier = ?;
+    `
+
+	session, err := scanPlaybackSession(q.QueryRowContext(ctx, query, sessionID, deviceID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.PlaybackSession{}, store.ErrSessionNotFound
+		}
+		return store.PlaybackSession{}, err
+	}
+
+	return session, nil
+}
+
+func scanPlaybackSession(row rowScanner) (store.PlaybackSession, error) {
+	var (
+		session    store.PlaybackSession
+		playlistID sql.NullInt64
+		endedAt    sql.NullTime
+	)
+
+	if err := row.Scan(&session.ID, &playlistID, &session.PlaylistName, &session.StartedAt, &endedAt, &session.EndReason); err != nil {
+		return store.PlaybackSession{}, err
+	}
+
+	if playlistID.Valid {
+		session.PlaylistID = &playlistID.Int64
+	}
+	if endedAt.Valid {
+		session.EndedAt = &endedAt.Time
+	}
+
+	return session, nil
+}
@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+// SaveDeviceSettings replaces the device's settings document.
+func (s *Store) SaveDeviceSettings(ctx context.Context, deviceID string, document json.RawMessage) (result store.DeviceSettings, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.DeviceSettings{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.DeviceSettings{}, err
+	}
+
+	const upsert = `
+        INSERT INTO device_settings (device_identifier, document)
+        VALUES (?, ?)
+        ON CONFLICT(device_identifier) DO UPDATE SET
+            document = excluded.document,
+            updated_at = CURRENT_TIMESTAMP;
+    `
+
+	if _, err = tx.ExecContext(ctx, upsert, deviceID, string(document)); err != nil {
+		return store.DeviceSettings{}, fmt.Errorf("storing device settings: %w", err)
+	}
+
+	if result, err = getDeviceSettings(ctx, tx, deviceID); err != nil {
+		return store.DeviceSettings{}, fmt.Errorf("reading device settings: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.DeviceSettings{}, fmt.Errorf("committing device settings: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetDeviceSettings returns store.ErrSettingsUnset for a device that has
+// never stored its settings.
+func (s *Store) GetDeviceSettings(ctx context.Context, deviceID string) (store.DeviceSettings, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return store.DeviceSettings{}, err
+	}
+
+	settings, err := getDeviceSettings(ctx, s.db, deviceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.DeviceSettings{}, store.ErrSettingsUnset
+		}
+		return store.DeviceSettings{}, fmt.Errorf("fetching device settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+func getDeviceSettings(ctx context.Context, q querier, deviceID string) (store.DeviceSettings, error) {
+	const query = `
+        SELECT document, updated_at
+        FROM device_settings
+        WHERE device_identifier = ?;
+    `
+
+	var (
+		settings store.DeviceSettings
+		document string
+	)
+
+	if err := q.QueryRowContext(ctx, query, deviceID).Scan(&document, &settings.UpdatedAt); err != nil {
+		return store.DeviceSettings{}, err
+	}
+
+	settings.Document = json.RawMessage(document)
+	return settings, nil
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+// StorageStats reports the database size from SQLite's page counters and a
+// row count for every user table.
+func (s *Store) StorageStats(ctx context.Context) (store.StorageStats, error) {
+	var pageCount, pageSize, freePages int64
+
+	if err := s.db.QueryRowContext(ctx, "PRAGMA page_count;").Scan(&pageCount); err != nil {
+		return store.StorageStats{}, fmt.Errorf("reading page count: %w", err)
+	}
+	if err := s.db.QueryRowContext(ctx, "PRAGMA page_size;").Scan(&pageSize); err != nil {
+		return store.StorageStats{}, fmt.Errorf("reading page size: %w", err)
+	}
+	if err := s.db.QueryRowContext(ctx, "PRAGMA freelist_count;").Scan(&freePages); err != nil {
+		return store.StorageStats{}, fmt.Errorf("reading freelist count: %w", err)
+	}
+
+	const listTables = `
+        SELECT name FROM sqlite_master
+        WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+        ORDER BY name;
+    `
+
+	rows, err := s.db.QueryContext(ctx, listTables)
+	if err != nil {
+		return store.StorageStats{}, fmt.Errorf("listing tables: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return store.StorageStats{}, fmt.Errorf("scanning table name: %w", err)
+		}
+		tables = append(tables, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return store.StorageStats{}, fmt.Errorf("iterating tables: %w", err)
+	}
+
+	stats := store.StorageStats{
+		DatabaseBytes: pageCount * pageSize,
+		FreeBytes:     freePages * pageSize,
+		TableRows:     make(map[string]int64, len(tables)),
+	}
+
+	for _, table := range tables {
+		var count int64
+		if err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %q;", table)).Scan(&count); err != nil {
+			return store.StorageStats{}, fmt.Errorf("counting %s rows: %w", table, err)
+		}
+		stats.TableRows[table] = count
+	}
+
+	return stats, nil
+}
@@ -5,25 +5,56 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
-
-	_ "github.com/mattn/go-sqlite3"
+	"time"
 
 	"sciplayer-api/internal/store"
 )
 
 type Store struct {
-	db *sql.DB
+	db   *tracedDB
+	opts Options
+}
+
+// Options configures store-level rules that apply to every caller.
+type Options struct {
+	// PlaylistUniqueness rejects playlists that duplicate an existing one on
+	// the same device. The zero value allows duplicates.
+	PlaylistUniqueness store.PlaylistUniqueness
+
+	// MaxPlaylistsPerDevice caps the active (non-trashed) playlists of a
+	// device. Zero means unlimited.
+	MaxPlaylistsPerDevice int
+
+	// SlowQueryThreshold logs statements that take at least this long to
+	// Logger, tagged with the request ID. Zero disables slow-query logging.
+	SlowQueryThreshold time.Duration
+	Logger             *log.Logger
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx so helpers can run inside
+// or outside a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-func New(dbPath string) (*Store, error) {
+const playlistColumns = `id, name, url, artwork_url, position, created_at, updated_at, deleted_at,
+            legal_hold_reason, legal_hold_at`
+
+func New(dbPath string, opts Options) (*Store, error) {
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
 		return nil, fmt.Errorf("creating database directory: %w", err)
 	}
 
-	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", dbPath)
-	db, err := sql.Open("sqlite3", dsn)
+	db, err := sql.Open(driverName, dsn(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("opening sqlite database: %w", err)
 	}
@@ -33,28 +64,38 @@ func New(dbPath string) (*Store, error) {
 	db.SetConnMaxLifetime(0)
 
 	if err := migrate(db); err != nil {
-		err := db.Close()
-		if err != nil {
-			return nil, err
+		if closeErr := db.Close(); closeErr != nil {
+			return nil, fmt.Errorf("closing database: %v (original error: %w)", closeErr, err)
 		}
 		return nil, err
 	}
 
-	return &Store{db: db}, nil
+	traced := &tracedDB{
+		DB:     db,
+		tracer: &tracer{logger: opts.Logger, slowThreshold: opts.SlowQueryThreshold},
+	}
+
+	return &Store{db: traced, opts: opts}, nil
 }
 
 func (s *Store) Close() error {
 	return s.db.Close()
 }
 
-func (s *Store) CreateDevice(ctx context.Context, deviceID string) (bool, error) {
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// CreateDevice registers a device. Registering an existing device is a no-op
+// and leaves its metadata untouched; use UpdateDevice to change it.
+func (s *Store) CreateDevice(ctx context.Context, deviceID string, meta store.DeviceMetadata) (bool, error) {
 	const query = `
-        INSERT INTO devices (device_identifier)
-        VALUES (?)
+        INSERT INTO devices (device_identifier, display_name, model, firmware_version)
+        VALUES (?, ?, ?, ?)
         ON CONFLICT(device_identifier) DO NOTHING;
     `
 
-	res, err := s.db.ExecContext(ctx, query, deviceID)
+	res, err := s.db.ExecContext(ctx, query, deviceID, meta.DisplayName, meta.Model, meta.FirmwareVersion)
 	if err != nil {
 		return false, fmt.Errorf("inserting device: %w", err)
 	}
@@ -67,10 +108,10 @@ func (s *Store) CreateDevice(ctx context.Context, deviceID string) (bool, error)
 	return affected > 0, nil
 }
 
-func (s *Store) AddPlaylist(ctx context.Context, deviceID, name, playlistURL string) (err error) {
+func (s *Store) AddPlaylist(ctx context.Context, deviceID string, playlist store.NewPlaylist) (pl store.Playlist, err error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("starting transaction: %w", err)
+		return store.Playlist{}, fmt.Errorf("starting transaction: %w", err)
 	}
 
 	defer func() {
@@ -81,53 +122,385 @@ func (s *Store) AddPlaylist(ctx context.Context, deviceID, name, playlistURL str
 		}
 	}()
 
-	const deviceCheck = `
-        SELECT 1 FROM devices WHERE device_identifier = ?;
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.Playlist{}, err
+	}
+
+	if pl, err = s.insertPlaylist(ctx, tx, deviceID, playlist); err != nil {
+		return store.Playlist{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.Playlist{}, fmt.Errorf("committing playlist insert: %w", err)
+	}
+
+	return pl, nil
+}
+
+// AddPlaylists inserts several playlists in one transaction. Duplicates and
+// items over the quota are reported per item and skipped; any other failure
+// aborts the whole batch.
+func (s *Store) AddPlaylists(ctx context.Context, deviceID string, playlists []store.NewPlaylist) (results []store.PlaylistResult, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return nil, err
+	}
+
+	results = make([]store.PlaylistResult, 0, len(playlists))
+	for _, item := range playlists {
+		pl, insertErr := s.insertPlaylist(ctx, tx, deviceID, item)
+		if insertErr != nil && !errors.Is(insertErr, store.ErrDuplicatePlaylist) && !errors.Is(insertErr, store.ErrPlaylistQuota) {
+			return nil, insertErr
+		}
+		results = append(results, store.PlaylistResult{Playlist: pl, Err: insertErr})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing playlist batch: %w", err)
+	}
+
+	return results, nil
+}
+
+func (s *Store) ListPlaylists(ctx context.Context, deviceID string) ([]store.Playlist, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return nil, err
+	}
+
+	return listPlaylists(ctx, s.db, deviceID)
+}
+
+func (s *Store) DeletePlaylist(ctx context.Context, deviceID string, playlistID int64) error {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return err
+	}
+
+	const query = `
+        UPDATE playlists
+        SET deleted_at = CURRENT_TIMESTAMP
+        WHERE id = ? AND device_identifier = ? AND deleted_at IS NULL
+          AND ` + playlistNotHeld + `;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, playlistID, deviceID)
+	if err != nil {
+		return fmt.Errorf("deleting playlist: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking delete result: %w", err)
+	}
+
+	if affected == 0 {
+		return playlistHoldError(ctx, s.db, deviceID, playlistID, true)
+	}
+
+	return nil
+}
+
+func (s *Store) GetPlaylist(ctx context.Context, deviceID string, playlistID int64) (store.Playlist, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return store.Playlist{}, err
+	}
+
+	return getPlaylist(ctx, s.db, deviceID, playlistID)
+}
+
+func (s *Store) UpdatePlaylist(ctx context.Context, deviceID string, playlistID int64, update store.PlaylistUpdate) (pl store.Playlist, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.Playlist{}, err
+	}
+
+	current, err := getPlaylist(ctx, tx, deviceID, playlistID)
+	if err != nil {
+		return store.Playlist{}, err
+	}
+
+	name, playlistURL := current.Name, current.URL
+	if update.Name != nil {
+		name = *update.Name
+	}
+	if update.URL != nil {
+		playlistURL = *update.URL
+	}
+
+	if err = s.checkDuplicate(ctx, tx, deviceID, playlistID, name, playlistURL); err != nil {
+		return store.Playlist{}, err
+	}
+
+	const query = `
+        UPDATE playlists
+        SET name = COALESCE(?, name),
+            url = COALESCE(?, url),
+            artwork_url = COALESCE(?, artwork_url),
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = ? AND device_identifier = ? AND deleted_at IS NULL;
+    `
+
+	res, err := tx.ExecContext(ctx, query, update.Name, update.URL, update.ArtworkURL, playlistID, deviceID)
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("updating playlist: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("checking update result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.Playlist{}, store.ErrPlaylistNotFound
+	}
+
+	if pl, err = getPlaylist(ctx, tx, deviceID, playlistID); err != nil {
+		return store.Playlist{}, fmt.Errorf("reading updated playlist: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.Playlist{}, fmt.Errorf("committing playlist update: %w", err)
+	}
+
+	return pl, nil
+}
+
+// ListDeletedPlaylists returns the device's playlists in the trash.
+func (s *Store) ListDeletedPlaylists(ctx context.Context, deviceID string) ([]store.Playlist, error) {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return nil, err
+	}
+
+	const query = `
+        SELECT ` + playlistColumns + `
+        FROM playlists
+        WHERE device_identifier = ? AND deleted_at IS NOT NULL
+        ORDER BY deleted_at DESC, id DESC;
+    `
+
+	rows, err := s.db.QueryContext(ctx, query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching deleted playlists: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	playlists := make([]store.Playlist, 0)
+	for rows.Next() {
+		pl, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning deleted playlist: %w", err)
+		}
+		playlists = append(playlists, pl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating deleted playlists: %w", err)
+	}
+
+	return playlists, nil
+}
+
+// RestorePlaylist moves a playlist out of the trash and appends it to the
+// end of the device's list.
+func (s *Store) RestorePlaylist(ctx context.Context, deviceID string, playlistID int64) (pl store.Playlist, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return store.Playlist{}, err
+	}
+
+	const selectDeleted = `
+        SELECT ` + playlistColumns + `
+        FROM playlists
+        WHERE id = ? AND device_identifier = ? AND deleted_at IS NOT NULL;
     `
 
-	if err = tx.QueryRowContext(ctx, deviceCheck, deviceID).Scan(new(int)); err != nil {
+	deleted, err := scanPlaylist(tx.QueryRowContext(ctx, selectDeleted, playlistID, deviceID))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return store.ErrDeviceNotFound
+			return store.Playlist{}, store.ErrPlaylistNotFound
 		}
-		return fmt.Errorf("checking device existence: %w", err)
+		return store.Playlist{}, fmt.Errorf("fetching deleted playlist: %w", err)
+	}
+
+	if err = s.checkDuplicate(ctx, tx, deviceID, playlistID, deleted.Name, deleted.URL); err != nil {
+		return store.Playlist{}, err
 	}
 
-	const insertPlaylist = `
-        INSERT INTO playlists (device_identifier, name, url)
-        VALUES (?, ?, ?);
+	if err = s.checkQuota(ctx, tx, deviceID); err != nil {
+		return store.Playlist{}, err
+	}
+
+	const restore = `
+        UPDATE playlists
+        SET deleted_at = NULL,
+            position = (
+                SELECT COALESCE(MAX(position), 0) + 1 FROM playlists
+                WHERE device_identifier = ? AND deleted_at IS NULL
+            )
+        WHERE id = ?;
     `
 
-	if _, err = tx.ExecContext(ctx, insertPlaylist, deviceID, name, playlistURL); err != nil {
-		return fmt.Errorf("inserting playlist: %w", err)
+	if _, err = tx.ExecContext(ctx, restore, deviceID, playlistID); err != nil {
+		return store.Playlist{}, fmt.Errorf("restoring playlist: %w", err)
+	}
+
+	if pl, err = getPlaylist(ctx, tx, deviceID, playlistID); err != nil {
+		return store.Playlist{}, fmt.Errorf("reading restored playlist: %w", err)
 	}
 
 	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("committing playlist insert: %w", err)
+		return store.Playlist{}, fmt.Errorf("committing playlist restore: %w", err)
+	}
+
+	return pl, nil
+}
+
+// PurgePlaylist removes a playlist permanently, whether or not it is in the
+// trash.
+func (s *Store) PurgePlaylist(ctx context.Context, deviceID string, playlistID int64) error {
+	if err := ensureDevice(ctx, s.db, deviceID); err != nil {
+		return err
+	}
+
+	const query = `
+        DELETE FROM playlists
+        WHERE id = ? AND device_identifier = ?
+          AND ` + playlistNotHeld + `;
+    `
+
+	res, err := s.db.ExecContext(ctx, query, playlistID, deviceID)
+	if err != nil {
+		return fmt.Errorf("purging playlist: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking purge result: %w", err)
+	}
+
+	if affected == 0 {
+		return playlistHoldError(ctx, s.db, deviceID, playlistID, false)
 	}
 
 	return nil
 }
 
-func (s *Store) ListPlaylists(ctx context.Context, deviceID string) ([]store.Playlist, error) {
-	const deviceCheck = `
-        SELECT 1 FROM devices WHERE device_identifier = ?;
+// ReorderPlaylists assigns positions following playlistIDs, which must list
+// every playlist of the device exactly once.
+func (s *Store) ReorderPlaylists(ctx context.Context, deviceID string, playlistIDs []int64) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, deviceID); err != nil {
+		return err
+	}
+
+	const countQuery = `
+        SELECT COUNT(*) FROM playlists WHERE device_identifier = ? AND deleted_at IS NULL;
     `
 
-	if err := s.db.QueryRowContext(ctx, deviceCheck, deviceID).Scan(new(int)); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, store.ErrDeviceNotFound
+	var count int
+	if err = tx.QueryRowContext(ctx, countQuery, deviceID).Scan(&count); err != nil {
+		return fmt.Errorf("counting playlists: %w", err)
+	}
+
+	if count != len(playlistIDs) {
+		return store.ErrInvalidPlaylistOrder
+	}
+
+	const updatePosition = `
+        UPDATE playlists
+        SET position = ?
+        WHERE id = ? AND device_identifier = ? AND deleted_at IS NULL;
+    `
+
+	seen := make(map[int64]struct{}, len(playlistIDs))
+	for i, id := range playlistIDs {
+		if _, dup := seen[id]; dup {
+			return store.ErrInvalidPlaylistOrder
+		}
+		seen[id] = struct{}{}
+
+		res, err := tx.ExecContext(ctx, updatePosition, i+1, id, deviceID)
+		if err != nil {
+			return fmt.Errorf("updating playlist position: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("checking position update: %w", err)
+		}
+		if affected == 0 {
+			return store.ErrPlaylistNotFound
 		}
-		return nil, fmt.Errorf("checking device existence: %w", err)
 	}
 
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing playlist reorder: %w", err)
+	}
+
+	return nil
+}
+
+func listPlaylists(ctx context.Context, q querier, deviceID string) ([]store.Playlist, error) {
 	const query = `
-        SELECT name, url, created_at
+        SELECT ` + playlistColumns + `
         FROM playlists
-        WHERE device_identifier = ?
-        ORDER BY created_at ASC, id ASC;
+        WHERE device_identifier = ? AND deleted_at IS NULL
+        ORDER BY position ASC, created_at ASC, id ASC;
     `
 
-	rows, err := s.db.QueryContext(ctx, query, deviceID)
+	rows, err := q.QueryContext(ctx, query, deviceID)
 	if err != nil {
 		return nil, fmt.Errorf("fetching playlists: %w", err)
 	}
@@ -140,8 +513,8 @@ func (s *Store) ListPlaylists(ctx context.Context, deviceID string) ([]store.Pla
 
 	playlists := make([]store.Playlist, 0)
 	for rows.Next() {
-		var pl store.Playlist
-		if err := rows.Scan(&pl.Name, &pl.URL, &pl.CreatedAt); err != nil {
+		pl, err := scanPlaylist(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scanning playlist: %w", err)
 		}
 		playlists = append(playlists, pl)
@@ -154,32 +527,879 @@ func (s *Store) ListPlaylists(ctx context.Context, deviceID string) ([]store.Pla
 	return playlists, nil
 }
 
-func migrate(db *sql.DB) error {
-	const createDevicesTable = `
-        CREATE TABLE IF NOT EXISTS devices (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            device_identifier TEXT NOT NULL UNIQUE,
-            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-        );
-    `
+// insertPlaylist appends a playlist to the end of the device's list after
+// applying the uniqueness rule. The caller must have checked the device.
+func (s *Store) insertPlaylist(ctx context.Context, q querier, deviceID string, playlist store.NewPlaylist) (store.Playlist, error) {
+	if err := s.checkDuplicate(ctx, q, deviceID, 0, playlist.Name, playlist.URL); err != nil {
+		return store.Playlist{}, err
+	}
 
-	const createPlaylistsTable = `
-        CREATE TABLE IF NOT EXISTS playlists (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            device_identifier TEXT NOT NULL,
-            name TEXT NOT NULL,
-            url TEXT NOT NULL,
-            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-            FOREIGN KEY (device_identifier) REFERENCES devices(device_identifier) ON DELETE CASCADE
-        );
+	if err := s.checkQuota(ctx, q, deviceID); err != nil {
+		return store.Playlist{}, err
+	}
+
+	const query = `
+        INSERT INTO playlists (device_identifier, name, url, artwork_url, position)
+        VALUES (?, ?, ?, ?, (
+            SELECT COALESCE(MAX(position), 0) + 1 FROM playlists
+            WHERE device_identifier = ? AND deleted_at IS NULL
+        ));
     `
 
-	if _, err := db.Exec(createDevicesTable); err != nil {
-		return fmt.Errorf("creating devices table: %w", err)
+	res, err := q.ExecContext(ctx, query, deviceID, playlist.Name, playlist.URL, playlist.ArtworkURL, deviceID)
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("inserting playlist: %w", err)
 	}
 
-	if _, err := db.Exec(createPlaylistsTable); err != nil {
-		return fmt.Errorf("creating playlists table: %w", err)
+	id, err := res.LastInsertId()
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("reading playlist id: %w", err)
+	}
+
+	pl, err := getPlaylist(ctx, q, deviceID, id)
+	if err != nil {
+		return store.Playlist{}, fmt.Errorf("reading inserted playlist: %w", err)
+	}
+
+	return pl, nil
+}
+
+// checkDuplicate applies the configured uniqueness rule, ignoring the
+// playlist with excludeID so updates don't conflict with themselves.
+func (s *Store) checkDuplicate(ctx context.Context, q querier, deviceID string, excludeID int64, name, playlistURL string) error {
+	var condition string
+	var args []any
+
+	switch s.opts.PlaylistUniqueness {
+	case store.UniqueByName:
+		condition, args = "name = ?", []any{name}
+	case store.UniqueByURL:
+		condition, args = "url = ?", []any{playlistURL}
+	case store.UniqueByNameURL:
+		condition, args = "name = ? AND url = ?", []any{name, playlistURL}
+	default:
+		return nil
+	}
+
+	query := `
+        SELECT ` + playlistColumns + `
+        FROM playlists
+        WHERE device_identifier = ? AND id != ? AND deleted_at IS NULL AND ` + condition + `
+        ORDER BY id ASC
+        LIMIT 1;
+    `
+
+	existing, err := scanPlaylist(q.QueryRowContext(ctx, query, append([]any{deviceID, excludeID}, args...)...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("checking for duplicate playlist: %w", err)
+	}
+
+	return &store.DuplicatePlaylistError{Existing: existing}
+}
+
+// CopyPlaylists appends the source device's playlists to the target device
+// in source order. A source playlist whose name already exists on the target
+// is skipped, or has its URL replaced when mode is store.CopyOverwrite.
+func (s *Store) CopyPlaylists(ctx context.Context, sourceID, targetID string, mode store.CopyMode) (result store.CopyResult, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.CopyResult{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensureDevice(ctx, tx, sourceID); err != nil {
+		return store.CopyResult{}, err
+	}
+
+	if err = ensureDevice(ctx, tx, targetID); err != nil {
+		return store.CopyResult{}, err
+	}
+
+	source, err := listPlaylists(ctx, tx, sourceID)
+	if err != nil {
+		return store.CopyResult{}, err
+	}
+
+	target, err := listPlaylists(ctx, tx, targetID)
+	if err != nil {
+		return store.CopyResult{}, err
+	}
+
+	existing := make(map[string]store.Playlist, len(target))
+	for _, pl := range target {
+		if _, ok := existing[pl.Name]; !ok {
+			existing[pl.Name] = pl
+		}
+	}
+
+	const overwriteURL = `
+        UPDATE playlists
+        SET url = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE id = ?;
+    `
+
+	for _, pl := range source {
+		if match, ok := existing[pl.Name]; ok {
+			if mode != store.CopyOverwrite || match.URL == pl.URL {
+				result.Skipped++
+				continue
+			}
+			if dupErr := s.checkDuplicate(ctx, tx, targetID, match.ID, pl.Name, pl.URL); dupErr != nil {
+				if !errors.Is(dupErr, store.ErrDuplicatePlaylist) {
+					return store.CopyResult{}, dupErr
+				}
+				result.Skipped++
+				continue
+			}
+			if _, err = tx.ExecContext(ctx, overwriteURL, pl.URL, match.ID); err != nil {
+				return store.CopyResult{}, fmt.Errorf("overwriting playlist: %w", err)
+			}
+			result.Overwritten++
+			continue
+		}
+
+		copied, insertErr := s.insertPlaylist(ctx, tx, targetID, store.NewPlaylist{
+			Name:       pl.Name,
+			URL:        pl.URL,
+			ArtworkURL: pl.ArtworkURL,
+		})
+		if insertErr != nil {
+			if !errors.Is(insertErr, store.ErrDuplicatePlaylist) {
+				return store.CopyResult{}, insertErr
+			}
+			result.Skipped++
+			continue
+		}
+		if err = copyTracks(ctx, tx, pl.ID, copied.ID); err != nil {
+			return store.CopyResult{}, err
+		}
+		existing[copied.Name] = copied
+		result.Copied++
+	}
+
+	if result.Playlists, err = listPlaylists(ctx, tx, targetID); err != nil {
+		return store.CopyResult{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.CopyResult{}, fmt.Errorf("committing playlist copy: %w", err)
+	}
+
+	return result, nil
+}
+
+// checkQuota fails when the device cannot take another active playlist.
+func (s *Store) checkQuota(ctx context.Context, q querier, deviceID string) error {
+	if s.opts.MaxPlaylistsPerDevice <= 0 {
+		return nil
+	}
+
+	const query = `
+        SELECT COUNT(*) FROM playlists WHERE device_identifier = ? AND deleted_at IS NULL;
+    `
+
+	var count int
+	if err := q.QueryRowContext(ctx, query, deviceID).Scan(&count); err != nil {
+		return fmt.Errorf("counting playlists: %w", err)
+	}
+
+	if count >= s.opts.MaxPlaylistsPerDevice {
+		return &store.PlaylistQuotaError{Limit: s.opts.MaxPlaylistsPerDevice}
+	}
+
+	return nil
+}
+
+// ensureDevice returns store.ErrDeviceNotFound when the device is not
+// registered.
+func ensureDevice(ctx context.Context, q querier, deviceID string) error {
+	const deviceCheck = `
+        SELECT 1 FROM devices WHERE device_identifier = ?;
+    `
+
+	if err := q.QueryRowContext(ctx, deviceCheck, deviceID).Scan(new(int)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.ErrDeviceNotFound
+		}
+		return fmt.Errorf("checking device existence: %w", err)
+	}
+
+	return nil
+}
+
+func getPlaylist(ctx context.Context, q querier, deviceID string, playlistID int64) (store.Playlist, error) {
+	const query = `
+        SELECT ` + playlistColumns + `
+        FROM playlists
+        WHERE id = ? AND device_identifier = ? AND deleted_at IS NULL;
+    `
+
+	pl, err := scanPlaylist(q.QueryRowContext(ctx, query, playlistID, deviceID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Playlist{}, store.ErrPlaylistNotFound
+		}
+		return store.Playlist{}, err
+	}
+
+	return pl, nil
+}
+
+// scanPlaylist reads a row selected with playlistColumns. Playlists that were
+// never updated report their creation time as UpdatedAt.
+func scanPlaylist(row rowScanner) (store.Playlist, error) {
+	var (
+		pl         store.Playlist
+		updatedAt  sql.NullTime
+		deletedAt  sql.NullTime
+		holdReason string
+		holdAt     sql.NullTime
+	)
+
+	err := row.Scan(
+		&pl.ID, &pl.Name, &pl.URL, &pl.ArtworkURL, &pl.Position, &pl.CreatedAt, &updatedAt, &deletedAt,
+		&holdReason, &holdAt,
+	)
+	if err != nil {
+		return store.Playlist{}, err
+	}
+
+	pl.UpdatedAt = pl.CreatedAt
+	if updatedAt.Valid {
+		pl.UpdatedAt = updatedAt.Time
+	}
+	if deletedAt.Valid {
+		pl.DeletedAt = &deletedAt.Time
+	}
+	pl.LegalHold = scanLegalHold(holdReason, holdAt)
+
+	return pl, nil
+}
+
+func migrate(db *sql.DB) error {
+	const createDevicesTable = `
+        CREATE TABLE IF NOT EXISTS devices (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            device_identifier TEXT NOT NULL UNIQUE,
+            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+        );
+    `
+
+	// A playlist belongs to either a device or a group. Group playlists share
+	// the table so they draw IDs from the same sequence and can have tracks
+	// and artwork like any other playlist.
+	const createPlaylistsTable = `
+        CREATE TABLE IF NOT EXISTS playlists (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            device_identifier TEXT,
+            group_id INTEGER,
+            name TEXT NOT NULL,
+            url TEXT NOT NULL,
+            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (device_identifier) REFERENCES devices(device_identifier) ON DELETE CASCADE,
+            FOREIGN KEY (group_id) REFERENCES device_groups(id) ON DELETE CASCADE,
+            CHECK ((device_identifier IS NULL) != (group_id IS NULL))
+        );
+    `
+
+	if _, err := db.Exec(createDevicesTable); err != nil {
+		return fmt.Errorf("creating devices table: %w", err)
+	}
+
+	if _, err := db.Exec(createPlaylistsTable); err != nil {
+		return fmt.Errorf("creating playlists table: %w", err)
+	}
+
+	for _, column := range []string{"display_name", "model", "firmware_version"} {
+		if err := addColumnIfMissing(db, "devices", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+
+	if err := addColumnIfMissing(db, "devices", "last_seen_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "devices", "last_ip", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "playlists", "updated_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	// Rows from before ordering support all sit at position 0 and fall back
+	// to creation order.
+	if err := addColumnIfMissing(db, "playlists", "position", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "playlists", "artwork_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "playlists", "deleted_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "devices", "playlist_order", "TEXT NOT NULL DEFAULT 'manual'"); err != nil {
+		return err
+	}
+
+	for _, column := range []string{"archived_at", "archive_warned_at"} {
+		if err := addColumnIfMissing(db, "devices", column, "DATETIME"); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range []string{"devices", "playlists"} {
+		if err := addColumnIfMissing(db, table, "legal_hold_reason", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		if err := addColumnIfMissing(db, table, "legal_hold_at", "DATETIME"); err != nil {
+			return err
+		}
+	}
+
+	if err := allowGroupPlaylists(db); err != nil {
+		return err
+	}
+
+	const createDeviceTagsTable = `
+        CREATE TABLE IF NOT EXISTS device_tags (
+            device_identifier TEXT NOT NULL,
+            tag TEXT NOT NULL,
+            PRIMARY KEY (device_identifier, tag),
+            FOREIGN KEY (device_identifier) REFERENCES devices(device_identifier) ON DELETE CASCADE
+        );
+    `
+
+	if _, err := db.Exec(createDeviceTagsTable); err != nil {
+		return fmt.Errorf("creating device tags table: %w", err)
+	}
+
+	const createDeviceTagsIndex = `
+        CREATE INDEX IF NOT EXISTS idx_device_tags_tag
+        ON device_tags (tag);
+    `
+
+	if _, err := db.Exec(createDeviceTagsIndex); err != nil {
+		return fmt.Errorf("creating device tags index: %w", err)
+	}
+
+	const createTracksTable = `
+        CREATE TABLE IF NOT EXISTS tracks (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            playlist_id INTEGER NOT NULL,
+            title TEXT NOT NULL DEFAULT '',
+            url TEXT NOT NULL,
+            position INTEGER NOT NULL DEFAULT 0,
+            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE
+        );
+    `
+
+	if _, err := db.Exec(createTracksTable); err != nil {
+		return fmt.Errorf("creating tracks table: %w", err)
+	}
+
+	for _, column := range []string{"artist", "album", "mime_type"} {
+		if err := addColumnIfMissing(db, "tracks", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+
+	if err := addColumnIfMissing(db, "tracks", "duration_seconds", "INTEGER"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "tracks", "content_hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "tracks", "artwork_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	const createTracksContentHashIndex = `
+        CREATE INDEX IF NOT EXISTS idx_tracks_playlist_content_hash
+        ON tracks (playlist_id, content_hash);
+    `
+
+	if _, err := db.Exec(createTracksContentHashIndex); err != nil {
+		return fmt.Errorf("creating tracks content hash index: %w", err)
+	}
+
+	const createTracksPlaylistIndex = `
+        CREATE INDEX IF NOT EXISTS idx_tracks_playlist_id
+        ON tracks (playlist_id);
+    `
+
+	if _, err := db.Exec(createTracksPlaylistIndex); err != nil {
+		return fmt.Errorf("creating tracks playlist index: %w", err)
+	}
+
+	const createRegistrationTokensTable = `
+        CREATE TABLE IF NOT EXISTS registration_tokens (
+            token_hash TEXT PRIMARY KEY,
+            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            expires_at DATETIME NOT NULL,
+            used_at DATETIME,
+            device_identifier TEXT
+        );
+    `
+
+	if _, err := db.Exec(createRegistrationTokensTable); err != nil {
+		return fmt.Errorf("creating registration tokens table: %w", err)
+	}
+
+	const createCatalogTable = `
+        CREATE TABLE IF NOT EXISTS catalog_entries (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            url TEXT NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+        );
+    `
+
+	if _, err := db.Exec(createCatalogTable); err != nil {
+		return fmt.Errorf("creating catalog table: %w", err)
+	}
+
+	if err := addColumnIfMissing(db, "catalog_entries", "artwork_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	const createGroupsTable = `
+        CREATE TABLE IF NOT EXISTS device_groups (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL UNIQUE,
+            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+        );
+    `
+
+	const createGroupMembersTable = `
+        CREATE TABLE IF NOT EXISTS device_group_members (
+            group_id INTEGER NOT NULL,
+            device_identifier TEXT NOT NULL,
+            PRIMARY KEY (group_id, device_identifier),
+            FOREIGN KEY (group_id) REFERENCES device_groups(id) ON DELETE CASCADE,
+            FOREIGN KEY (device_identifier) REFERENCES devices(device_identifier) ON DELETE CASCADE
+        );
+    `
+
+	if _, err := db.Exec(createGroupsTable); err != nil {
+		return fmt.Errorf("creating device groups table: %w", err)
+	}
+
+	if _, err := db.Exec(createGroupMembersTable); err != nil {
+		return fmt.Errorf("creating device group members table: %w", err)
+	}
+
+	const createTrackFeedbackTable = `
+        CREATE TABLE IF NOT EXISTS track_feedback (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            track_id INTEGER NOT NULL,
+            event TEXT NOT NULL,
+            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (track_id) REFERENCES tracks(id) ON DELETE CASCADE
+        );
+    `
+
+	if _, err := db.Exec(createTrackFeedbackTable); err != nil {
+		return fmt.Errorf("creating track feedback table: %w", err)
+	}
+
+	const createTrackFeedbackIndex = `
+        CREATE INDEX IF NOT EXISTS idx_track_feedback_track_id
+        ON track_feedback (track_id);
+    `
+
+	if _, err := db.Exec(createTrackFeedbackIndex); err != nil {
+		return fmt.Errorf("creating track feedback index: %w", err)
+	}
+
+	const createArtworkTable = `
+        CREATE TABLE IF NOT EXISTS artwork_cache (
+            id TEXT PRIMARY KEY,
+            url TEXT NOT NULL,
+            content_type TEXT NOT NULL,
+            data BLOB NOT NULL,
+            fetched_at DATETIME NOT NULL
+        );
+    `
+
+	if _, err := db.Exec(createArtworkTable); err != nil {
+		return fmt.Errorf("creating artwork cache table: %w", err)
+	}
+
+	const createPlaybackPositionsTable = `
+        CREATE TABLE IF NOT EXISTS playback_positions (
+            device_identifier TEXT NOT NULL,
+            track_id INTEGER NOT NULL,
+            position_seconds INTEGER NOT NULL,
+            updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (device_identifier, track_id),
+            FOREIGN KEY (device_identifier) REFERENCES devices(device_identifier) ON DELETE CASCADE,
+            FOREIGN KEY (track_id) REFERENCES tracks(id) ON DELETE CASCADE
+        );
+    `
+
+	if _, err := db.Exec(createPlaybackPositionsTable); err != nil {
+		return fmt.Errorf("creating playback positions table: %w", err)
+	}
+
+	const createNowPlayingTable = `
+        CREATE TABLE IF NOT EXISTS now_playing (
+            device_identifier TEXT PRIMARY KEY,
+            playlist_id INTEGER,
+            track_id INTEGER,
+            position_seconds INTEGER NOT NULL DEFAULT 0,
+            updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (device_identifier) REFERENCES devices(device_identifier) ON DELETE CASCADE
+        );
+    `
+
+	if _, err := db.Exec(createNowPlayingTable); err != nil {
+		return fmt.Errorf("creating now playing table: %w", err)
+	}
+
+	const createDeviceSettingsTable = `
+        CREATE TABLE IF NOT EXISTS device_settings (
+            device_identifier TEXT PRIMARY KEY,
+            document TEXT NOT NULL,
+            updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (device_identifier) REFERENCES devices(device_identifier) ON DELETE CASCADE
+        );
+    `
+
+	if _, err := db.Exec(createDeviceSettingsTable); err != nil {
+		return fmt.Errorf("creating device settings table: %w", err)
+	}
+
+	// Playback history is kept when the device is deleted and only removed
+	// by a purge, so it has no foreign key on the device.
+	const createPlaybackEventsTable = `
+        CREATE TABLE IF NOT EXISTS playback_events (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            device_identifier TEXT NOT NULL,
+            track_id INTEGER,
+            playlist_id INTEGER,
+            title TEXT NOT NULL DEFAULT '',
+            artist TEXT NOT NULL DEFAULT '',
+            url TEXT NOT NULL,
+            started_at DATETIME NOT NULL,
+            FOREIGN KEY (track_id) REFERENCES tracks(id) ON DELETE SET NULL,
+            FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE SET NULL
+        );
+    `
+
+	if _, err := db.Exec(createPlaybackEventsTable); err != nil {
+		return fmt.Errorf("creating playback events table: %w", err)
+	}
+
+	if err := addColumnIfMissing(db, "playback_events", "duration_seconds", "INTEGER"); err != nil {
+		return err
+	}
+
+	const createPlaybackEventsIndex = `
+        CREATE INDEX IF NOT EXISTS idx_playback_events_device_started
+        ON playback_events (device_identifier, started_at);
+    `
+
+	if _, err := db.Exec(createPlaybackEventsIndex); err != nil {
+		return fmt.Errorf("creating playback events index: %w", err)
+	}
+
+	// Sessions are playback history like playback_events and are kept when
+	// the device is deleted without a purge.
+	const createPlaybackSessionsTable = `
+        CREATE TABLE IF NOT EXISTS playback_sessions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            device_identifier TEXT NOT NULL,
+            playlist_id INTEGER,
+            playlist_name TEXT NOT NULL,
+            started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            ended_at DATETIME,
+            end_reason TEXT NOT NULL DEFAULT '',
+            FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE SET NULL
+        );
+    `
+
+	if _, err := db.Exec(createPlaybackSessionsTable); err != nil {
+		return fmt.Errorf("creating playback sessions table: %w", err)
+	}
+
+	const createPlaybackSessionsIndex = `
+        CREATE INDEX IF NOT EXISTS idx_playback_sessions_device_started
+        ON playback_sessions (device_identifier, started_at);
+    `
+
+	if _, err := db.Exec(createPlaybackSessionsIndex); err != nil {
+		return fmt.Errorf("creating playback sessions index: %w", err)
+	}
+
+	const createCommandsTable = `
+        CREATE TABLE IF NOT EXISTS device_commands (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            device_identifier TEXT NOT NULL,
+            type TEXT NOT NULL,
+            volume INTEGER,
+            playlist_id INTEGER,
+            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            expires_at DATETIME NOT NULL,
+            acknowledged_at DATETIME,
+            FOREIGN KEY (device_identifier) REFERENCES devices(device_identifier) ON DELETE CASCADE,
+            FOREIGN KEY (playlist_id) REFERENCES playlists(id) ON DELETE CASCADE
+        );
+    `
+
+	if _, err := db.Exec(createCommandsTable); err != nil {
+		return fmt.Errorf("creating device commands table: %w", err)
+	}
+
+	if err := addColumnIfMissing(db, "device_commands", "status", "TEXT NOT NULL DEFAULT 'pending'"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "device_commands", "error", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "device_commands", "completed_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	// Commands acknowledged before statuses were tracked were delivered.
+	const backfillCommandStatus = `
+        UPDATE device_commands
+        SET status = 'delivered'
+        WHERE status = 'pending' AND acknowledged_at IS NOT NULL;
+    `
+
+	if _, err := db.Exec(backfillCommandStatus); err != nil {
+		return fmt.Errorf("backfilling command status: %w", err)
+	}
+
+	const createCommandsIndex = `
+        CREATE INDEX IF NOT EXISTS idx_device_commands_device
+        ON device_commands (device_identifier, acknowledged_at);
+    `
+
+	if _, err := db.Exec(createCommandsIndex); err != nil {
+		return fmt.Errorf("creating device commands index: %w", err)
+	}
+
+	const createPlaylistsDeviceIndex = `
+        CREATE INDEX IF NOT EXISTS idx_playlists_device_identifier
+        ON playlists (device_identifier);
+    `
+
+	if _, err := db.Exec(createPlaylistsDeviceIndex); err != nil {
+		return fmt.Errorf("creating playlists device index: %w", err)
+	}
+
+	return nil
+}
+
+// allowGroupPlaylists rebuilds a playlists table created before group
+// playlists, whose device_identifier is NOT NULL and which has no group_id.
+// SQLite cannot drop a constraint in place, so the rows are copied into a new
+// table that replaces the old one. Foreign keys are off meanwhile so that
+// dropping the old table does not cascade to tracks and the other tables
+// that reference playlists, and the AUTOINCREMENT sequence is carried over so
+// IDs of purged playlists are not handed out again.
+func allowGroupPlaylists(db *sql.DB) (err error) {
+	notNull, err := columnNotNull(db, "playlists", "device_identifier")
+	if err != nil {
+		return err
+	}
+	if !notNull {
+		return nil
+	}
+
+	if _, err := db.Exec(`PRAGMA foreign_keys = OFF;`); err != nil {
+		return fmt.Errorf("disabling foreign keys: %w", err)
+	}
+	defer func() {
+		if _, fkErr := db.Exec(`PRAGMA foreign_keys = ON;`); fkErr != nil && err == nil {
+			err = fmt.Errorf("enabling foreign keys: %w", fkErr)
+		}
+	}()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	var sequence sql.NullInt64
+	err = tx.QueryRow(`SELECT seq FROM sqlite_sequence WHERE name = 'playlists';`).Scan(&sequence)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("reading playlist id sequence: %w", err)
+	}
+
+	const create = `
+        CREATE TABLE playlists_rebuilt (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            device_identifier TEXT,
+            group_id INTEGER,
+            name TEXT NOT NULL,
+            url TEXT NOT NULL,
+            created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            updated_at DATETIME,
+            position INTEGER NOT NULL DEFAULT 0,
+            artwork_url TEXT NOT NULL DEFAULT '',
+            deleted_at DATETIME,
+            legal_hold_reason TEXT NOT NULL DEFAULT '',
+            legal_hold_at DATETIME,
+            FOREIGN KEY (device_identifier) REFERENCES devices(device_identifier) ON DELETE CASCADE,
+            FOREIGN KEY (group_id) REFERENCES device_groups(id) ON DELETE CASCADE,
+            CHECK ((device_identifier IS NULL) != (group_id IS NULL))
+        );
+    `
+
+	const columns = `id, device_identifier, name, url, created_at, updated_at, position, artwork_url,
+            deleted_at, legal_hold_reason, legal_hold_at`
+
+	statements := []struct {
+		query string
+		step  string
+	}{
+		{create, "creating rebuilt playlists table"},
+		{`INSERT INTO playlists_rebuilt (` + columns + `) SELECT ` + columns + ` FROM playlists;`, "copying playlists"},
+		{`DROP TABLE playlists;`, "dropping old playlists table"},
+		{`ALTER TABLE playlists_rebuilt RENAME TO playlists;`, "renaming rebuilt playlists table"},
+	}
+
+	for _, stmt := range statements {
+		if _, err = tx.Exec(stmt.query); err != nil {
+			return fmt.Errorf("%s: %w", stmt.step, err)
+		}
+	}
+
+	if sequence.Valid {
+		const restoreSequence = `
+            UPDATE sqlite_sequence SET seq = MAX(seq, ?) WHERE name = 'playlists';
+        `
+
+		res, err := tx.Exec(restoreSequence, sequence.Int64)
+		if err != nil {
+			return fmt.Errorf("restoring playlist id sequence: %w", err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("checking playlist id sequence: %w", err)
+		}
+
+		// The rebuilt table has no sequence yet when there were no rows to copy.
+		if affected == 0 {
+			if _, err = tx.Exec(`INSERT INTO sqlite_sequence (name, seq) VALUES ('playlists', ?);`, sequence.Int64); err != nil {
+				return fmt.Errorf("restoring playlist id sequence: %w", err)
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing playlists rebuild: %w", err)
+	}
+
+	return nil
+}
+
+// columnNotNull reports whether the column is declared NOT NULL.
+func columnNotNull(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return false, fmt.Errorf("inspecting %s table: %w", table, err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, fmt.Errorf("scanning %s table info: %w", table, err)
+		}
+		if name == column {
+			return notNull, nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("iterating %s table info: %w", table, err)
+	}
+
+	return false, fmt.Errorf("%s table has no %s column", table, column)
+}
+
+// addColumnIfMissing brings databases created by older releases up to date.
+// SQLite has no ADD COLUMN IF NOT EXISTS, so the table layout is inspected
+// first.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return fmt.Errorf("inspecting %s table: %w", table, err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return fmt.Errorf("scanning %s table info: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating %s table info: %w", table, err)
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition)); err != nil {
+		return fmt.Errorf("adding %s.%s column: %w", table, column, err)
 	}
 
 	return nil
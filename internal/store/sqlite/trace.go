@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/reqid"
+)
+
+// tracer prefixes statements with the request ID as an SQL comment and logs
+// statements slower than the configured threshold.
+type tracer struct {
+	logger        *log.Logger
+	slowThreshold time.Duration
+}
+
+// tracedDB wraps *sql.DB so every statement issued by the store, including
+// those inside transactions, passes through the tracer.
+type tracedDB struct {
+	*sql.DB
+	tracer *tracer
+}
+
+type tracedTx struct {
+	*sql.Tx
+	tracer *tracer
+}
+
+func (db *tracedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*tracedTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, tracer: db.tracer}, nil
+}
+
+func (db *tracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer db.tracer.observe(ctx, query, time.Now())
+	return db.DB.ExecContext(ctx, db.tracer.annotate(ctx, query), args...)
+}
+
+func (db *tracedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer db.tracer.observe(ctx, query, time.Now())
+	return db.DB.QueryContext(ctx, db.tracer.annotate(ctx, query), args...)
+}
+
+func (db *tracedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer db.tracer.observe(ctx, query, time.Now())
+	return db.DB.QueryRowContext(ctx, db.tracer.annotate(ctx, query), args...)
+}
+
+func (tx *tracedTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer tx.tracer.observe(ctx, query, time.Now())
+	return tx.Tx.ExecContext(ctx, tx.tracer.annotate(ctx, query), args...)
+}
+
+func (tx *tracedTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer tx.tracer.observe(ctx, query, time.Now())
+	return tx.Tx.QueryContext(ctx, tx.tracer.annotate(ctx, query), args...)
+}
+
+func (tx *tracedTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer tx.tracer.observe(ctx, query, time.Now())
+	return tx.Tx.QueryRowContext(ctx, tx.tracer.annotate(ctx, query), args...)
+}
+
+func (t *tracer) annotate(ctx context.Context, query string) string {
+	id := reqid.FromContext(ctx)
+	if id == "" || !reqid.Valid(id) {
+		return query
+	}
+	return "/* req:" + id + " */ " + query
+}
+
+func (t *tracer) observe(ctx context.Context, query string, start time.Time) {
+	if t.logger == nil || t.slowThreshold <= 0 {
+		return
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < t.slowThreshold {
+		return
+	}
+
+	id := reqid.FromContext(ctx)
+	if id == "" {
+		id = "-"
+	}
+	t.logger.Printf("slow query req=%s %s: %s", id, elapsed, strings.Join(strings.Fields(query), " "))
+}
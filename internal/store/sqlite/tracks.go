@@ -0,0 +1,475 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sciplayer-api/internal/store"
+)
+
+const trackColumns = `id, playlist_id, url, content_hash, position, created_at,
+            title, artist, album, duration_seconds, mime_type, artwork_url`
+
+// AddTrack appends a track to the end of an active playlist. When the track
+// carries a content hash already present in the playlist, the existing
+// track is returned instead and created is false.
+func (s *Store) AddTrack(ctx context.Context, deviceID string, playlistID int64, track store.NewTrack) (t store.Track, created bool, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Track{}, false, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensurePlaylist(ctx, tx, deviceID, playlistID); err != nil {
+		return store.Track{}, false, err
+	}
+
+	if track.ContentHash != "" {
+		const findByHash = `
+            SELECT ` + trackColumns + `
+            FROM tracks
+            WHERE playlist_id = ? AND content_hash = ?
+            ORDER BY id ASC
+            LIMIT 1;
+        `
+
+		existing, scanErr := scanTrack(tx.QueryRowContext(ctx, findByHash, playlistID, track.ContentHash))
+		switch {
+		case scanErr == nil:
+			if err = tx.Commit(); err != nil {
+				return store.Track{}, false, fmt.Errorf("committing track lookup: %w", err)
+			}
+			return existing, false, nil
+		case !errors.Is(scanErr, sql.ErrNoRows):
+			return store.Track{}, false, fmt.Errorf("looking up track by content hash: %w", scanErr)
+		}
+	}
+
+	const query = `
+        INSERT INTO tracks (playlist_id, url, content_hash, title, artist, album, duration_seconds, mime_type, artwork_url, position)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, (
+            SELECT COALESCE(MAX(position), 0) + 1 FROM tracks
+            WHERE playlist_id = ?
+        ));
+    `
+
+	res, err := tx.ExecContext(ctx, query,
+		playlistID, track.URL, track.ContentHash,
+		track.Title, track.Artist, track.Album, track.DurationSeconds, track.MimeType, track.ArtworkURL,
+		playlistID,
+	)
+	if err != nil {
+		return store.Track{}, false, fmt.Errorf("inserting track: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return store.Track{}, false, fmt.Errorf("reading track id: %w", err)
+	}
+
+	if err = touchPlaylist(ctx, tx, playlistID); err != nil {
+		return store.Track{}, false, err
+	}
+
+	if t, err = getTrack(ctx, tx, playlistID, id); err != nil {
+		return store.Track{}, false, fmt.Errorf("reading inserted track: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.Track{}, false, fmt.Errorf("committing track insert: %w", err)
+	}
+
+	return t, true, nil
+}
+
+func (s *Store) ListTracks(ctx context.Context, deviceID string, playlistID int64) ([]store.Track, error) {
+	if err := ensurePlaylist(ctx, s.db, deviceID, playlistID); err != nil {
+		return nil, err
+	}
+
+	return listTracks(ctx, s.db, playlistID)
+}
+
+// UpdateTrack changes the given fields of a track and returns the result.
+// Tracks of a held playlist cannot be changed.
+func (s *Store) UpdateTrack(ctx context.Context, deviceID string, playlistID, trackID int64, update store.TrackUpdate) (t store.Track, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Track{}, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensurePlaylist(ctx, tx, deviceID, playlistID); err != nil {
+		return store.Track{}, err
+	}
+
+	if err = ensurePlaylistNotHeld(ctx, tx, playlistID); err != nil {
+		return store.Track{}, err
+	}
+
+	const query = `
+        UPDATE tracks
+        SET url = COALESCE(?, url),
+            title = COALESCE(?, title),
+            artist = COALESCE(?, artist),
+            album = COALESCE(?, album),
+            duration_seconds = COALESCE(?, duration_seconds),
+            mime_type = COALESCE(?, mime_type),
+            artwork_url = COALESCE(?, artwork_url)
+        WHERE id = ? AND playlist_id = ?;
+    `
+
+	res, err := tx.ExecContext(ctx, query,
+		update.URL, update.Title, update.Artist, update.Album, update.DurationSeconds, update.MimeType, update.ArtworkURL,
+		trackID, playlistID,
+	)
+	if err != nil {
+		return store.Track{}, fmt.Errorf("updating track: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return store.Track{}, fmt.Errorf("checking update result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.Track{}, store.ErrTrackNotFound
+	}
+
+	if err = touchPlaylist(ctx, tx, playlistID); err != nil {
+		return store.Track{}, err
+	}
+
+	if t, err = getTrack(ctx, tx, playlistID, trackID); err != nil {
+		return store.Track{}, fmt.Errorf("reading updated track: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return store.Track{}, fmt.Errorf("committing track update: %w", err)
+	}
+
+	return t, nil
+}
+
+func (s *Store) DeleteTrack(ctx context.Context, deviceID string, playlistID, trackID int64) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensurePlaylist(ctx, tx, deviceID, playlistID); err != nil {
+		return err
+	}
+
+	if err = ensurePlaylistNotHeld(ctx, tx, playlistID); err != nil {
+		return err
+	}
+
+	const query = `
+        DELETE FROM tracks
+        WHERE id = ? AND playlist_id = ?;
+    `
+
+	res, err := tx.ExecContext(ctx, query, trackID, playlistID)
+	if err != nil {
+		return fmt.Errorf("deleting track: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking delete result: %w", err)
+	}
+
+	if affected == 0 {
+		return store.ErrTrackNotFound
+	}
+
+	if err = touchPlaylist(ctx, tx, playlistID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing track delete: %w", err)
+	}
+
+	return nil
+}
+
+// ReorderTracks assigns positions following trackIDs, which must list every
+// track of the playlist exactly once. Nothing changes unless the whole order
+// is valid.
+func (s *Store) ReorderTracks(ctx context.Context, deviceID string, playlistID int64, trackIDs []int64) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensurePlaylist(ctx, tx, deviceID, playlistID); err != nil {
+		return err
+	}
+
+	const countQuery = `
+        SELECT COUNT(*) FROM tracks WHERE playlist_id = ?;
+    `
+
+	var count int
+	if err = tx.QueryRowContext(ctx, countQuery, playlistID).Scan(&count); err != nil {
+		return fmt.Errorf("counting tracks: %w", err)
+	}
+
+	if count != len(trackIDs) {
+		return store.ErrInvalidTrackOrder
+	}
+
+	const updatePosition = `
+        UPDATE tracks
+        SET position = ?
+        WHERE id = ? AND playlist_id = ?;
+    `
+
+	seen := make(map[int64]struct{}, len(trackIDs))
+	for i, id := range trackIDs {
+		if _, dup := seen[id]; dup {
+			return store.ErrInvalidTrackOrder
+		}
+		seen[id] = struct{}{}
+
+		res, err := tx.ExecContext(ctx, updatePosition, i+1, id, playlistID)
+		if err != nil {
+			return fmt.Errorf("updating track position: %w", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("checking position update: %w", err)
+		}
+		if affected == 0 {
+			return store.ErrInvalidTrackOrder
+		}
+	}
+
+	if err = touchPlaylist(ctx, tx, playlistID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("committing track reorder: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceTracks swaps the playlist's tracks for the given list in one
+// transaction, numbering them in order. A held playlist keeps its tracks.
+func (s *Store) ReplaceTracks(ctx context.Context, deviceID string, playlistID int64, tracks []store.NewTrack) (result []store.Track, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = fmt.Errorf("rolling back transaction: %v (original error: %w)", rollbackErr, err)
+			}
+		}
+	}()
+
+	if err = ensurePlaylist(ctx, tx, deviceID, playlistID); err != nil {
+		return nil, err
+	}
+
+	if err = ensurePlaylistNotHeld(ctx, tx, playlistID); err != nil {
+		return nil, err
+	}
+
+	const clearTracks = `
+        DELETE FROM tracks
+        WHERE playlist_id = ?;
+    `
+
+	if _, err = tx.ExecContext(ctx, clearTracks, playlistID); err != nil {
+		return nil, fmt.Errorf("clearing tracks: %w", err)
+	}
+
+	const insert = `
+        INSERT INTO tracks (playlist_id, url, content_hash, title, artist, album, duration_seconds, mime_type, artwork_url, position)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+    `
+
+	for i, track := range tracks {
+		_, err = tx.ExecContext(ctx, insert,
+			playlistID, track.URL, track.ContentHash,
+			track.Title, track.Artist, track.Album, track.DurationSeconds, track.MimeType, track.ArtworkURL,
+			i+1,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("inserting track: %w", err)
+		}
+	}
+
+	if err = touchPlaylist(ctx, tx, playlistID); err != nil {
+		return nil, err
+	}
+
+	if result, err = listTracks(ctx, tx, playlistID); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing track replacement: %w", err)
+	}
+
+	return result, nil
+}
+
+// ensurePlaylist checks that the device exists and owns an active playlist
+// with the given id.
+func ensurePlaylist(ctx context.Context, q querier, deviceID string, playlistID int64) error {
+	if err := ensureDevice(ctx, q, deviceID); err != nil {
+		return err
+	}
+
+	_, err := getPlaylist(ctx, q, deviceID, playlistID)
+	return err
+}
+
+// touchPlaylist bumps the playlist's updatedAt after its tracks change so
+// devices know to fetch them again.
+func touchPlaylist(ctx context.Context, q querier, playlistID int64) error {
+	const query = `
+        UPDATE playlists
+        SET updated_at = CURRENT_TIMESTAMP
+        WHERE id = ?;
+    `
+
+	if _, err := q.ExecContext(ctx, query, playlistID); err != nil {
+		return fmt.Errorf("touching playlist: %w", err)
+	}
+
+	return nil
+}
+
+// copyTracks duplicates the tracks of one playlist onto another, keeping
+// their order.
+func copyTracks(ctx context.Context, q querier, fromPlaylistID, toPlaylistID int64) error {
+	const query = `
+        INSERT INTO tracks (playlist_id, url, content_hash, title, artist, album, duration_seconds, mime_type, artwork_url, position)
+        SELECT ?, url, content_hash, title, artist, album, duration_seconds, mime_type, artwork_url, position
+        FROM tracks
+        WHERE playlist_id = ?
+        ORDER BY position ASC, id ASC;
+    `
+
+	if _, err := q.ExecContext(ctx, query, toPlaylistID, fromPlaylistID); err != nil {
+		return fmt.Errorf("copying tracks: %w", err)
+	}
+
+	return nil
+}
+
+func listTracks(ctx context.Context, q querier, playlistID int64) ([]store.Track, error) {
+	const query = `
+        SELECT ` + trackColumns + `
+        FROM tracks
+        WHERE playlist_id = ?
+        ORDER BY position ASC, id ASC;
+    `
+
+	rows, err := q.QueryContext(ctx, query, playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching tracks: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	tracks := make([]store.Track, 0)
+	for rows.Next() {
+		t, err := scanTrack(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning track: %w", err)
+		}
+		tracks = append(tracks, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating tracks: %w", err)
+	}
+
+	return tracks, nil
+}
+
+func getTrack(ctx context.Context, q querier, playlistID, trackID int64) (store.Track, error) {
+	const query = `
+        SELECT ` + trackColumns + `
+        FROM tracks
+        WHERE id = ? AND playlist_id = ?;
+    `
+
+	t, err := scanTrack(q.QueryRowContext(ctx, query, trackID, playlistID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Track{}, store.ErrTrackNotFound
+		}
+		return store.Track{}, err
+	}
+
+	return t, nil
+}
+
+func scanTrack(row rowScanner) (store.Track, error) {
+	var (
+		t        store.Track
+		duration sql.NullInt64
+	)
+
+	err := row.Scan(
+		&t.ID, &t.PlaylistID, &t.URL, &t.ContentHash, &t.Position, &t.CreatedAt,
+		&t.Title, &t.Artist, &t.Album, &duration, &t.MimeType, &t.ArtworkURL,
+	)
+	if err != nil {
+		return store.Track{}, err
+	}
+	if duration.Valid {
+		seconds := int(duration.Int64)
+		t.DurationSeconds = &seconds
+	}
+
+	return t, nil
+}
@@ -2,21 +2,621 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 )
 
-var ErrDeviceNotFound = errors.New("device not found")
+var (
+	ErrDeviceNotFound   = errors.New("device not found")
+	ErrDeviceExists     = errors.New("device already exists")
+	ErrPlaylistNotFound = errors.New("playlist not found")
+	ErrTrackNotFound    = errors.New("track not found")
+	ErrGroupNotFound    = errors.New("group not found")
+	ErrCatalogNotFound  = errors.New("catalog entry not found")
+	ErrGroupExists      = errors.New("group already exists")
+	ErrNowPlayingUnset  = errors.New("now playing not reported")
+	ErrArtworkNotFound  = errors.New("artwork not found")
+	ErrLegalHold        = errors.New("under legal hold")
+	ErrCommandNotFound  = errors.New("command not found")
+	ErrCommandFinished  = errors.New("command already finished")
+	ErrSessionNotFound  = errors.New("playback session not found")
+	ErrSettingsUnset    = errors.New("device settings not stored")
+
+	ErrInvalidRegistrationToken = errors.New("invalid or expired registration token")
+
+	ErrInvalidPlaylistOrder = errors.New("playlist order must list every playlist exactly once")
+	ErrInvalidTrackOrder    = errors.New("track order must list every track exactly once")
+	ErrDuplicatePlaylist    = errors.New("duplicate playlist")
+	ErrPlaylistQuota        = errors.New("playlist quota exceeded")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+)
+
+// PlaylistUniqueness selects which playlist fields must be unique per device.
+type PlaylistUniqueness string
+
+const (
+	UniqueNone      PlaylistUniqueness = "none"
+	UniqueByName    PlaylistUniqueness = "name"
+	UniqueByURL     PlaylistUniqueness = "url"
+	UniqueByNameURL PlaylistUniqueness = "both"
+)
+
+func ParsePlaylistUniqueness(value string) (PlaylistUniqueness, error) {
+	switch u := PlaylistUniqueness(value); u {
+	case "":
+		return UniqueNone, nil
+	case UniqueNone, UniqueByName, UniqueByURL, UniqueByNameURL:
+		return u, nil
+	default:
+		return "", fmt.Errorf("unknown playlist uniqueness %q (want none, name, url or both)", value)
+	}
+}
+
+// PlaylistOrder selects how a device's playlists are ordered when served.
+type PlaylistOrder string
+
+const (
+	OrderManual       PlaylistOrder = "manual"
+	OrderAlphabetical PlaylistOrder = "alphabetical"
+	OrderNewest       PlaylistOrder = "newest"
+)
+
+func ParsePlaylistOrder(value string) (PlaylistOrder, error) {
+	switch o := PlaylistOrder(value); o {
+	case "":
+		return OrderManual, nil
+	case OrderManual, OrderAlphabetical, OrderNewest:
+		return o, nil
+	default:
+		return "", fmt.Errorf("unknown playlist order %q (want manual, alphabetical or newest)", value)
+	}
+}
+
+// CommandType is a remote-control action queued for a device.
+type CommandType string
+
+const (
+	CommandPlay           CommandType = "play"
+	CommandPause          CommandType = "pause"
+	CommandNext           CommandType = "next"
+	CommandVolume         CommandType = "volume"
+	CommandSwitchPlaylist CommandType = "switch-playlist"
+)
+
+func ParseCommandType(value string) (CommandType, error) {
+	switch t := CommandType(value); t {
+	case CommandPlay, CommandPause, CommandNext, CommandVolume, CommandSwitchPlaylist:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown command type %q (want play, pause, next, volume or switch-playlist)", value)
+	}
+}
+
+// CommandStatus is where a command is in its lifecycle. Pending commands
+// become delivered when the device acknowledges them, then executed or
+// failed when it reports the outcome. Expired is never stored; it is how a
+// pending command reads once its TTL has passed.
+type CommandStatus string
+
+const (
+	CommandPending   CommandStatus = "pending"
+	CommandDelivered CommandStatus = "delivered"
+	CommandExecuted  CommandStatus = "executed"
+	CommandFailed    CommandStatus = "failed"
+	CommandExpired   CommandStatus = "expired"
+)
+
+// ParseCommandAckStatus accepts the statuses a device may report. An empty
+// value acknowledges delivery.
+func ParseCommandAckStatus(value string) (CommandStatus, error) {
+	switch s := CommandStatus(value); s {
+	case "":
+		return CommandDelivered, nil
+	case CommandDelivered, CommandExecuted, CommandFailed:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown command status %q (want delivered, executed or failed)", value)
+	}
+}
+
+// DuplicatePlaylistError is returned when a playlist would violate the
+// configured uniqueness rule. It matches ErrDuplicatePlaylist with errors.Is.
+type DuplicatePlaylistError struct {
+	Existing Playlist
+}
+
+func (e *DuplicatePlaylistError) Error() string {
+	return fmt.Sprintf("duplicate of playlist %d", e.Existing.ID)
+}
+
+func (e *DuplicatePlaylistError) Is(target error) bool {
+	return target == ErrDuplicatePlaylist
+}
+
+type Device struct {
+	ID            string
+	CreatedAt     time.Time
+	PlaylistCount int
+	DeviceMetadata
+	// LastSeenAt is nil until the device sends its first heartbeat.
+	LastSeenAt *time.Time
+	LastIP     string
+	// Tags are sorted and never nil.
+	Tags []string
+	// LegalHold is set while the device may not be deleted.
+	LegalHold     *LegalHold
+	PlaylistOrder PlaylistOrder
+	// ArchivedAt is set once the device was archived for inactivity.
+	ArchivedAt *time.Time
+}
+
+// LegalHold blocks deletion of a device or playlist until it is released.
+type LegalHold struct {
+	Reason   string
+	PlacedAt time.Time
+}
+
+// Heartbeat is what a device reports when it checks in. Empty fields leave
+// the stored values unchanged.
+type Heartbeat struct {
+	FirmwareVersion string
+	IP              string
+}
+
+// NowPlaying is what a device last reported as playing. PlaylistID and
+// TrackID are nil while the device is stopped. They are stored as reported
+// and may refer to group playlists.
+type NowPlaying struct {
+	PlaylistID      *int64
+	TrackID         *int64
+	PositionSeconds int
+	UpdatedAt       time.Time
+}
+
+// DeviceSettings is the audio configuration a device last stored, kept as
+// the JSON document the API validated so new settings need no migration.
+type DeviceSettings struct {
+	Document  json.RawMessage
+	UpdatedAt time.Time
+}
+
+// PlaybackPosition is the resume point a device saved for one of its tracks.
+type PlaybackPosition struct {
+	TrackID         int64
+	PlaylistID      int64
+	PositionSeconds int
+	UpdatedAt       time.Time
+}
+
+// PlaybackEvent records a device starting a track. Title, Artist, URL and
+// DurationSeconds are copied from the track when the event is recorded, so
+// history stays readable after the track is removed; TrackID and PlaylistID
+// become nil then.
+type PlaybackEvent struct {
+	ID              int64
+	TrackID         *int64
+	PlaylistID      *int64
+	Title           string
+	Artist          string
+	URL             string
+	DurationSeconds *int
+	StartedAt       time.Time
+}
+
+// PlaybackEventFilter selects a device's playback history, events or
+// sessions by start time. Since is inclusive and Until exclusive; zero
+// values leave that end open.
+type PlaybackEventFilter struct {
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// NewCommand is a command to queue. Volume is set for CommandVolume and
+// PlaylistID for CommandSwitchPlaylist. The command is dropped undelivered
+// once ExpiresAt passes.
+type NewCommand struct {
+	Type       CommandType
+	Volume     *int
+	PlaylistID *int64
+	ExpiresAt  time.Time
+}
+
+// Command is a queued remote-control command. AcknowledgedAt is set once
+// the device confirms it received the command, and CompletedAt once it
+// reports the command executed or failed, with Error for failures.
+type Command struct {
+	ID         int64
+	Type       CommandType
+	Volume     *int
+	PlaylistID *int64
+	Status     CommandStatus
+	Error      string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+
+	AcknowledgedAt *time.Time
+	CompletedAt    *time.Time
+}
+
+// StatusAt reports the command's status as of now, marking pending commands
+// past their TTL as expired.
+func (c Command) StatusAt(now time.Time) CommandStatus {
+	if c.Status == CommandPending && !c.ExpiresAt.After(now) {
+		return CommandExpired
+	}
+	return c.Status
+}
+
+// CommandAck is a device's report on a command. Error is only kept for
+// CommandFailed.
+type CommandAck struct {
+	Status CommandStatus
+	Error  string
+}
+
+// SessionEndReason records how a playback session ended.
+type SessionEndReason string
+
+const (
+	// SessionClosed sessions were closed by the device.
+	SessionClosed SessionEndReason = "closed"
+	// SessionReplaced sessions ended because the device opened another.
+	SessionReplaced SessionEndReason = "replaced"
+	// SessionTimedOut sessions were closed after the device stopped
+	// checking in; they end at its last heartbeat.
+	SessionTimedOut SessionEndReason = "timeout"
+)
+
+// PlaybackSession is a stretch of time a device spent playing a playlist.
+// EndedAt and EndReason are unset while the session is open. PlaylistName
+// is copied when the session opens, so it outlives the playlist.
+type PlaybackSession struct {
+	ID           int64
+	PlaylistID   *int64
+	PlaylistName string
+	StartedAt    time.Time
+	EndedAt      *time.Time
+	EndReason    SessionEndReason
+}
+
+// PlaybackStats summarises a device's playback history over a time range.
+// Playlists are ordered by play count, most played first.
+type PlaybackStats struct {
+	TotalPlays          int
+	TotalListenSeconds  int
+	TotalSessions       int
+	TotalSessionSeconds int
+	Playlists           []PlaylistPlayStats
+}
+
+// PlaylistPlayStats aggregates the plays of one playlist. PlaylistID is nil
+// for plays whose playlist has since been removed; they are counted
+// together. A play counts the track's duration towards ListenSeconds, or
+// the time until the device started its next track if that came sooner.
+// Plays of tracks without a known duration add nothing. SessionSeconds sums
+// the sessions started in the range, counting open sessions up to now.
+type PlaylistPlayStats struct {
+	PlaylistID     *int64
+	Name           string
+	Plays          int
+	ListenSeconds  int
+	Sessions       int
+	SessionSeconds int
+}
+
+// DeviceMetadata is the descriptive information a device reports about
+// itself. All fields are optional.
+type DeviceMetadata struct {
+	DisplayName     string
+	Model           string
+	FirmwareVersion string
+}
+
+// DeviceUpdate carries the metadata fields to change; nil fields are left
+// as they are.
+type DeviceUpdate struct {
+	DisplayName     *string
+	Model           *string
+	FirmwareVersion *string
+	// Tags, when non-nil, replaces the device's tags.
+	Tags          *[]string
+	PlaylistOrder *PlaylistOrder
+}
+
+// DeviceFilter selects a page of devices. Cursor is the NextCursor of the
+// previous page, or empty for the first page.
+type DeviceFilter struct {
+	Limit  int
+	Cursor string
+	// Tag, when set, keeps only devices carrying that tag.
+	Tag string
+	// SeenSince, when set, keeps devices whose last heartbeat is at or after
+	// it. NotSeenSince keeps devices whose last heartbeat is before it or
+	// that never sent one.
+	SeenSince    time.Time
+	NotSeenSince time.Time
+	// Archived selects archived devices instead of active ones.
+	Archived bool
+}
+
+// DevicePage is one page of devices. NextCursor is empty on the last page.
+type DevicePage struct {
+	Devices    []Device
+	NextCursor string
+}
 
 type Playlist struct {
-	Name      string
-	URL       string
-	CreatedAt time.Time
+	ID         int64
+	Name       string
+	URL        string
+	ArtworkURL string
+	Position   int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	// DeletedAt is set while the playlist is in the trash.
+	DeletedAt *time.Time
+	// GroupID is set on playlists a device inherits from one of its groups.
+	GroupID int64
+	// LegalHold is set while the playlist may not be deleted.
+	LegalHold *LegalHold
+}
+
+// Track is one entry of a file-based playlist.
+type Track struct {
+	ID          int64
+	PlaylistID  int64
+	URL         string
+	ContentHash string
+	Position    int
+	CreatedAt   time.Time
+	TrackMetadata
+}
+
+// TrackMetadata describes a track for display on the device. All fields are
+// optional; DurationSeconds is nil when unknown.
+type TrackMetadata struct {
+	Title           string
+	Artist          string
+	Album           string
+	DurationSeconds *int
+	MimeType        string
+	ArtworkURL      string
+}
+
+// TrackUpdate carries the track fields to change; nil fields are left as
+// they are.
+type TrackUpdate struct {
+	URL             *string
+	Title           *string
+	Artist          *string
+	Album           *string
+	DurationSeconds *int
+	MimeType        *string
+	ArtworkURL      *string
+}
+
+// NewTrack is a track to be appended to a playlist.
+type NewTrack struct {
+	URL string
+	// ContentHash, when set, identifies the media file. Adding a track whose
+	// hash already exists in the playlist returns the existing track.
+	ContentHash string
+	TrackMetadata
+}
+
+// ImportedDevice is a device with its playlists, converted from another
+// system's export.
+type ImportedDevice struct {
+	ID string
+	DeviceMetadata
+	Playlists []ImportedPlaylist
+}
+
+// ImportedPlaylist is a playlist to create on an imported device, with its
+// tracks in play order.
+type ImportedPlaylist struct {
+	NewPlaylist
+	Tracks []NewTrack
+}
+
+// ImportSummary counts what an import created. Devices that already existed
+// keep their metadata and only gain playlists; playlists that would break
+// the uniqueness rule are skipped.
+type ImportSummary struct {
+	DevicesCreated   int
+	DevicesExisting  int
+	PlaylistsCreated int
+	PlaylistsSkipped int
+	TracksCreated    int
+}
+
+// CatalogEntry is a curated playlist that any device can install.
+type CatalogEntry struct {
+	ID          int64
+	Name        string
+	URL         string
+	ArtworkURL  string
+	Description string
+	CreatedAt   time.Time
+}
+
+// Group is a named set of devices that share the group's playlists.
+type Group struct {
+	ID          int64
+	Name        string
+	CreatedAt   time.Time
+	DeviceCount int
+}
+
+// PlaylistQuotaError is returned when a device already holds the maximum
+// number of active playlists. It matches ErrPlaylistQuota with errors.Is.
+type PlaylistQuotaError struct {
+	Limit int
+}
+
+func (e *PlaylistQuotaError) Error() string {
+	return fmt.Sprintf("device already has the maximum of %d playlists", e.Limit)
+}
+
+func (e *PlaylistQuotaError) Is(target error) bool {
+	return target == ErrPlaylistQuota
+}
+
+type NewPlaylist struct {
+	Name       string
+	URL        string
+	ArtworkURL string
+}
+
+// PlaylistResult is the outcome of one item in a batch insert. Err is set,
+// and Playlist is empty, when the item was rejected.
+type PlaylistResult struct {
+	Playlist Playlist
+	Err      error
+}
+
+// FeedbackEvent is a listener reaction a device reports for a track.
+type FeedbackEvent string
+
+const (
+	FeedbackLike    FeedbackEvent = "like"
+	FeedbackDislike FeedbackEvent = "dislike"
+	FeedbackSkip    FeedbackEvent = "skip"
+)
+
+// TrackFeedback counts the feedback events recorded for a track.
+type TrackFeedback struct {
+	Likes    int
+	Dislikes int
+	Skips    int
+}
+
+// CopyMode decides what happens when a copied playlist's name already exists
+// on the target device.
+type CopyMode string
+
+const (
+	CopySkip      CopyMode = "skip"
+	CopyOverwrite CopyMode = "overwrite"
+)
+
+type CopyResult struct {
+	Copied      int
+	Overwritten int
+	Skipped     int
+	// Playlists is the target device's full list after the copy.
+	Playlists []Playlist
+}
+
+type StorageStats struct {
+	DatabaseBytes int64
+	// FreeBytes is space inside the database file that is allocated but
+	// unused, reclaimable with VACUUM.
+	FreeBytes int64
+	TableRows map[string]int64
+}
+
+// PlaylistUpdate holds the fields to change on a playlist. Nil fields are left
+// untouched.
+type PlaylistUpdate struct {
+	Name       *string
+	URL        *string
+	ArtworkURL *string
+}
+
+// Artwork is a cached copy of an artwork image referenced by a playlist or
+// track.
+type Artwork struct {
+	ID          string
+	URL         string
+	ContentType string
+	Data        []byte
+	FetchedAt   time.Time
+}
+
+// ArtworkID derives the stable identifier under which an artwork URL is
+// proxied.
+func ArtworkID(artworkURL string) string {
+	sum := sha256.Sum256([]byte(artworkURL))
+	return hex.EncodeToString(sum[:16])
 }
 
 type Store interface {
-	CreateDevice(ctx context.Context, deviceID string) (bool, error)
-	AddPlaylist(ctx context.Context, deviceID, name, playlistURL string) error
+	CreateDevice(ctx context.Context, deviceID string, meta DeviceMetadata) (bool, error)
+	CreateRegistrationToken(ctx context.Context, tokenHash string, expiresAt time.Time) error
+	RegisterDevice(ctx context.Context, tokenHash, deviceID string, meta DeviceMetadata) error
+	GetDevice(ctx context.Context, deviceID string) (Device, error)
+	UpdateDevice(ctx context.Context, deviceID string, update DeviceUpdate) (Device, error)
+	RecordHeartbeat(ctx context.Context, deviceID string, hb Heartbeat) error
+	SetNowPlaying(ctx context.Context, deviceID string, np NowPlaying) (NowPlaying, error)
+	GetNowPlaying(ctx context.Context, deviceID string) (NowPlaying, error)
+	SaveDeviceSettings(ctx context.Context, deviceID string, document json.RawMessage) (DeviceSettings, error)
+	GetDeviceSettings(ctx context.Context, deviceID string) (DeviceSettings, error)
+	SavePlaybackPosition(ctx context.Context, deviceID string, trackID int64, positionSeconds int) (PlaybackPosition, error)
+	ListPlaybackPositions(ctx context.Context, deviceID string) ([]PlaybackPosition, error)
+	RecordPlaybackEvent(ctx context.Context, deviceID string, trackID int64, startedAt time.Time) (PlaybackEvent, error)
+	ListPlaybackEvents(ctx context.Context, deviceID string, filter PlaybackEventFilter) ([]PlaybackEvent, error)
+	GetPlaybackStats(ctx context.Context, deviceID string, since, until time.Time) (PlaybackStats, error)
+	OpenPlaybackSession(ctx context.Context, deviceID string, playlistID int64) (PlaybackSession, error)
+	ClosePlaybackSession(ctx context.Context, deviceID string, sessionID int64) (PlaybackSession, error)
+	ListPlaybackSessions(ctx context.Context, deviceID string, filter PlaybackEventFilter) ([]PlaybackSession, error)
+	CloseStaleSessions(ctx context.Context, seenBefore time.Time) (int, error)
+	EnqueueCommand(ctx context.Context, deviceID string, cmd NewCommand) (Command, error)
+	PendingCommands(ctx context.Context, deviceID string, now time.Time) ([]Command, error)
+	GetCommand(ctx context.Context, deviceID string, commandID int64) (Command, error)
+	AcknowledgeCommand(ctx context.Context, deviceID string, commandID int64, ack CommandAck) (Command, error)
+	ListDevices(ctx context.Context, filter DeviceFilter) (DevicePage, error)
+	RenameDevice(ctx context.Context, oldID, newID string) (Device, error)
+	DeleteDevice(ctx context.Context, deviceID string, purge bool) error
+	WarnInactiveDevices(ctx context.Context, inactiveSince time.Time) ([]string, error)
+	ArchiveInactiveDevices(ctx context.Context, inactiveSince, warnedBefore time.Time) ([]string, error)
+	UnarchiveDevice(ctx context.Context, deviceID string) (Device, error)
+	SetDeviceLegalHold(ctx context.Context, deviceID string, hold *LegalHold) error
+	SetPlaylistLegalHold(ctx context.Context, deviceID string, playlistID int64, hold *LegalHold) error
+	AddPlaylist(ctx context.Context, deviceID string, playlist NewPlaylist) (Playlist, error)
+	AddPlaylists(ctx context.Context, deviceID string, playlists []NewPlaylist) ([]PlaylistResult, error)
+	ImportDevices(ctx context.Context, devices []ImportedDevice) (ImportSummary, error)
 	ListPlaylists(ctx context.Context, deviceID string) ([]Playlist, error)
+	GetPlaylist(ctx context.Context, deviceID string, playlistID int64) (Playlist, error)
+	UpdatePlaylist(ctx context.Context, deviceID string, playlistID int64, update PlaylistUpdate) (Playlist, error)
+	DeletePlaylist(ctx context.Context, deviceID string, playlistID int64) error
+	ListDeletedPlaylists(ctx context.Context, deviceID string) ([]Playlist, error)
+	RestorePlaylist(ctx context.Context, deviceID string, playlistID int64) (Playlist, error)
+	PurgePlaylist(ctx context.Context, deviceID string, playlistID int64) error
+	ReorderPlaylists(ctx context.Context, deviceID string, playlistIDs []int64) error
+	AddTrack(ctx context.Context, deviceID string, playlistID int64, track NewTrack) (Track, bool, error)
+	ListTracks(ctx context.Context, deviceID string, playlistID int64) ([]Track, error)
+	UpdateTrack(ctx context.Context, deviceID string, playlistID, trackID int64, update TrackUpdate) (Track, error)
+	DeleteTrack(ctx context.Context, deviceID string, playlistID, trackID int64) error
+	ReorderTracks(ctx context.Context, deviceID string, playlistID int64, trackIDs []int64) error
+	ReplaceTracks(ctx context.Context, deviceID string, playlistID int64, tracks []NewTrack) ([]Track, error)
+	RecordTrackFeedback(ctx context.Context, deviceID string, playlistID, trackID int64, event FeedbackEvent) error
+	GetTrackFeedback(ctx context.Context, deviceID string, playlistID, trackID int64) (TrackFeedback, error)
+	CopyPlaylists(ctx context.Context, sourceID, targetID string, mode CopyMode) (CopyResult, error)
+	ListInheritedPlaylists(ctx context.Context, deviceID string) ([]Playlist, error)
+	CreateGroup(ctx context.Context, name string) (Group, error)
+	GetGroup(ctx context.Context, groupID int64) (Group, error)
+	ListGroups(ctx context.Context) ([]Group, error)
+	DeleteGroup(ctx context.Context, groupID int64) error
+	AddGroupDevice(ctx context.Context, groupID int64, deviceID string) error
+	RemoveGroupDevice(ctx context.Context, groupID int64, deviceID string) error
+	ListGroupDevices(ctx context.Context, groupID int64) ([]string, error)
+	AddGroupPlaylist(ctx context.Context, groupID int64, playlist NewPlaylist) (Playlist, error)
+	ListGroupPlaylists(ctx context.Context, groupID int64) ([]Playlist, error)
+	DeleteGroupPlaylist(ctx context.Context, groupID, playlistID int64) error
+	AddCatalogEntry(ctx context.Context, playlist NewPlaylist, description string) (CatalogEntry, error)
+	ListCatalog(ctx context.Context) ([]CatalogEntry, error)
+	DeleteCatalogEntry(ctx context.Context, entryID int64) error
+	InstallCatalogEntry(ctx context.Context, deviceID string, entryID int64) (Playlist, error)
+	FindArtworkURL(ctx context.Context, artworkID string) (string, error)
+	GetArtwork(ctx context.Context, artworkID string) (Artwork, error)
+	SaveArtwork(ctx context.Context, artwork Artwork) error
+	StorageStats(ctx context.Context) (StorageStats, error)
+	Ping(ctx context.Context) error
 	Close() error
 }
@@ -0,0 +1,157 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sciplayer-api/internal/store"
+)
+
+// Syncer mirrors one device's playlists from a central sciplayer-api
+// instance into the local store. The upstream copy is the source of truth:
+// local playlists are added, removed and reordered to match it.
+type Syncer struct {
+	baseURL  string
+	deviceID string
+	store    store.Store
+	client   *http.Client
+	interval time.Duration
+	logger   *log.Logger
+}
+
+type remotePlaylist struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func NewSyncer(baseURL, deviceID string, s store.Store, interval time.Duration, logger *log.Logger) *Syncer {
+	return &Syncer{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		deviceID: deviceID,
+		store:    s,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run syncs immediately and then on every interval until ctx is cancelled.
+// Failures are logged and retried on the next tick so the device keeps
+// playing from its local copy while offline.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.SyncOnce(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Printf("upstream sync failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Syncer) SyncOnce(ctx context.Context) error {
+	remote, err := s.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.store.CreateDevice(ctx, s.deviceID, store.DeviceMetadata{}); err != nil {
+		return fmt.Errorf("registering local device: %w", err)
+	}
+
+	local, err := s.store.ListPlaylists(ctx, s.deviceID)
+	if err != nil {
+		return fmt.Errorf("listing local playlists: %w", err)
+	}
+
+	// Pool local playlists by content so unchanged entries keep their IDs.
+	available := make(map[remotePlaylist][]int64, len(local))
+	for _, pl := range local {
+		key := remotePlaylist{Name: pl.Name, URL: pl.URL}
+		available[key] = append(available[key], pl.ID)
+	}
+
+	order := make([]int64, 0, len(remote))
+	var added, removed int
+	for _, item := range remote {
+		if ids := available[item]; len(ids) > 0 {
+			order = append(order, ids[0])
+			available[item] = ids[1:]
+			continue
+		}
+
+		pl, err := s.store.AddPlaylist(ctx, s.deviceID, store.NewPlaylist{Name: item.Name, URL: item.URL})
+		if err != nil {
+			return fmt.Errorf("adding playlist %q: %w", item.Name, err)
+		}
+		order = append(order, pl.ID)
+		added++
+	}
+
+	for _, ids := range available {
+		for _, id := range ids {
+			err := s.store.PurgePlaylist(ctx, s.deviceID, id)
+			if errors.Is(err, store.ErrLegalHold) {
+				// Held playlists stay on the device, after the upstream ones.
+				order = append(order, id)
+				continue
+			}
+			if err != nil && !errors.Is(err, store.ErrPlaylistNotFound) {
+				return fmt.Errorf("removing playlist %d: %w", id, err)
+			}
+			removed++
+		}
+	}
+
+	if err := s.store.ReorderPlaylists(ctx, s.deviceID, order); err != nil {
+		return fmt.Errorf("reordering playlists: %w", err)
+	}
+
+	if added > 0 || removed > 0 {
+		s.logger.Printf("upstream sync: %d added, %d removed, %d total", added, removed, len(order))
+	}
+
+	return nil
+}
+
+func (s *Syncer) fetch(ctx context.Context) ([]remotePlaylist, error) {
+	endpoint := fmt.Sprintf("%s/devices/%s/playlists", s.baseURL, url.PathEscape(s.deviceID))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building upstream request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching upstream playlists: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching upstream playlists: unexpected status %s", resp.Status)
+	}
+
+	var playlists []remotePlaylist
+	if err := json.NewDecoder(resp.Body).Decode(&playlists); err != nil {
+		return nil, fmt.Errorf("decoding upstream playlists: %w", err)
+	}
+
+	return playlists, nil
+}